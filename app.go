@@ -1,23 +1,98 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 type app struct {
-	router *mux.Router
-	server *http.Server
-	logger *log.Logger
+	router  *mux.Router
+	server  *http.Server
+	logger  *slog.Logger
+	stopped []component
 }
 
-func (a *app) ListenAndServe(port string) {
-	a.server.Addr = port
+type component struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// OnStop registers a component to stop once the server has drained. Components stop
+// in registration order, so workers go before the clients they use.
+func (a *app) OnStop(name string, stop func(ctx context.Context) error) {
+	a.stopped = append(a.stopped, component{name: name, stop: stop})
+}
+
+// Run serves on addr until SIGINT or SIGTERM. It then stops accepting connections,
+// waits for in-flight requests and stops the registered components, all within
+// shutdownTimeout, so the process exits before the orchestrator kills it.
+func (a *app) Run(addr string, shutdownTimeout time.Duration) error {
+	a.server.Addr = addr
 	a.server.Handler = a.router
-	a.logger.Println("Server listening on port ", port)
-	err := a.server.ListenAndServe()
-	if err != nil {
-		a.logger.Fatal("Can't start server, err: ", err.Error())
+
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	served := make(chan error, 1)
+	go func() {
+		a.logger.Info("server listening", "addr", addr)
+		served <- a.server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-served:
+		a.logger.Error("can't serve", "err", err)
+	case <-ctx.Done():
+		// A second signal kills the process.
+		stopSignals()
+	}
+	a.logger.Info("shutting down", "timeout", shutdownTimeout)
+	deadline, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err == nil {
+		err = a.shutdown(deadline)
+	}
+	a.stopComponents(deadline)
+	return err
+}
+
+func (a *app) shutdown(ctx context.Context) error {
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.logger.Error("error draining requests, closing connections", "err", err)
+		return errors.Join(err, a.server.Close())
+	}
+	return nil
+}
+
+func (a *app) stopComponents(ctx context.Context) {
+	for _, c := range a.stopped {
+		if err := c.stop(ctx); err != nil {
+			a.logger.Error("error stopping", "component", c.name, "err", err)
+			continue
+		}
+		a.logger.Info("stopped", "component", c.name)
+	}
+}
+
+// stopping adapts a Stop method without errors to OnStop.
+func stopping(stop func()) func(ctx context.Context) error {
+	return func(context.Context) error {
+		stop()
+		return nil
+	}
+}
+
+// closing adapts a Close method to OnStop.
+func closing(close func() error) func(ctx context.Context) error {
+	return func(context.Context) error {
+		return close()
 	}
 }
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"TaskService/i18n"
+	"TaskService/ratelimit"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config is the whole service configuration. Each setting has a key in the config file,
+// its json tag within the section, and an env var that overrides the file.
+type Config struct {
+	HTTP          HTTP          `json:"http"`
+	Auth          Auth          `json:"auth"`
+	Postgres      Postgres      `json:"postgres"`
+	Redis         Redis         `json:"redis"`
+	Elasticsearch Elasticsearch `json:"elasticsearch"`
+	Log           Log           `json:"log"`
+	Tracing       Tracing       `json:"tracing"`
+	Ready         Ready         `json:"ready"`
+	Languages     Languages     `json:"languages"`
+	Access        Access        `json:"access"`
+	RateLimits    RateLimits    `json:"rateLimits"`
+	Media         Media         `json:"media"`
+	Reminders     Reminders     `json:"reminders"`
+	Webhooks      Webhooks      `json:"webhooks"`
+	Reconcile     Reconcile     `json:"reconcile"`
+}
+
+type HTTP struct {
+	Addr string `json:"addr" env:"HTTP_ADDR"`
+	// MetricsAddr serves /metrics apart from the API, so it is reachable only where
+	// this port is, e.g. by the Prometheus on the internal network.
+	MetricsAddr       string        `json:"metricsAddr" env:"METRICS_ADDR"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `json:"readTimeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `json:"writeTimeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `json:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `json:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For is believed.
+	TrustedProxies []string `json:"trustedProxies" env:"TRUSTED_PROXIES"`
+}
+
+// Auth is the VK OAuth app. EndRedirectURL is where the user lands after logging in.
+type Auth struct {
+	ClientID       string `json:"clientId" env:"CLIENT_ID"`
+	ClientSecret   string `json:"clientSecret" env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL    string `json:"redirectUrl" env:"REDIRECT_URL"`
+	EndRedirectURL string `json:"endRedirectUrl" env:"END_REDIRECT_URL"`
+}
+
+// Postgres is the server URL without the database, which the service creates itself.
+type Postgres struct {
+	URL     string        `json:"url" env:"DATABASE_URL" secret:"url"`
+	Timeout time.Duration `json:"timeout" env:"POSTGRES_TIMEOUT"`
+}
+
+type Redis struct {
+	Addr    string        `json:"addr" env:"REDIS_URL"`
+	Timeout time.Duration `json:"timeout" env:"REDIS_TIMEOUT"`
+}
+
+type Elasticsearch struct {
+	Addresses []string      `json:"addresses" env:"ELASTICSEARCH_URL"`
+	Timeout   time.Duration `json:"timeout" env:"ES_TIMEOUT"`
+}
+
+type Log struct {
+	Level string `json:"level" env:"LOG_LEVEL"`
+}
+
+// Tracing picks the span exporter: "otlp", "stdout" or "none".
+type Tracing struct {
+	Exporter string `json:"exporter" env:"TRACING_EXPORTER"`
+}
+
+// Ready configures /readyz: HardDependencies make the app not ready when down.
+type Ready struct {
+	Timeout          time.Duration `json:"timeout" env:"READY_TIMEOUT"`
+	HardDependencies []string      `json:"hardDependencies" env:"READY_HARD_DEPENDENCIES"`
+}
+
+// Languages are the content languages: Default, which base posts are written in,
+// and Supported ones that posts can be translated into.
+type Languages struct {
+	Default   string   `json:"default" env:"DEFAULT_LANG"`
+	Supported []string `json:"supported" env:"SUPPORTED_LANGS"`
+}
+
+// Access lists the VK ids of moderators and editors. Admins are editors too.
+type Access struct {
+	Admins  []int64 `json:"admins" env:"ADMIN_VK_IDS"`
+	Editors []int64 `json:"editors" env:"EDITOR_VK_IDS"`
+}
+
+// RateLimits override the limit of a route group, e.g. "30/1m,10". Empty keeps the default.
+type RateLimits struct {
+	Search  string `json:"search" env:"RATE_LIMIT_SEARCH"`
+	Vote    string `json:"vote" env:"RATE_LIMIT_VOTE"`
+	Default string `json:"default" env:"RATE_LIMIT_DEFAULT"`
+}
+
+// Media picks the media backend: "local" for files under Dir served by the app,
+// "s3" for an S3-compatible bucket.
+type Media struct {
+	Backend   string `json:"backend" env:"MEDIA_BACKEND"`
+	MaxBytes  int64  `json:"maxBytes" env:"MEDIA_MAX_BYTES"`
+	Dir       string `json:"dir" env:"MEDIA_DIR"`
+	PublicURL string `json:"publicUrl" env:"MEDIA_PUBLIC_URL"`
+	S3        S3     `json:"s3"`
+}
+
+type S3 struct {
+	Endpoint  string `json:"endpoint" env:"S3_ENDPOINT"`
+	Bucket    string `json:"bucket" env:"S3_BUCKET"`
+	Region    string `json:"region" env:"S3_REGION"`
+	AccessKey string `json:"accessKey" env:"S3_ACCESS_KEY"`
+	SecretKey string `json:"secretKey" env:"S3_SECRET_KEY" secret:"true"`
+	PublicURL string `json:"publicUrl" env:"S3_PUBLIC_URL"`
+}
+
+// Reminders picks the reminder channel: "vk" to message users from the community
+// of VkGroupToken, "log" to only log reminders.
+type Reminders struct {
+	Channel      string        `json:"channel" env:"REMINDER_CHANNEL"`
+	VkGroupToken string        `json:"vkGroupToken" env:"VK_GROUP_TOKEN" secret:"true"`
+	Interval     time.Duration `json:"interval" env:"REMINDER_INTERVAL"`
+}
+
+type Webhooks struct {
+	Interval time.Duration `json:"interval" env:"WEBHOOK_INTERVAL"`
+}
+
+type Reconcile struct {
+	Interval time.Duration `json:"interval" env:"RECONCILE_INTERVAL"`
+}
+
+// Default returns the settings used when neither the file nor env sets them.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Addr:              ":8080",
+			MetricsAddr:       ":9090",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Postgres:      Postgres{Timeout: 5 * time.Second},
+		Redis:         Redis{Timeout: time.Second},
+		Elasticsearch: Elasticsearch{Addresses: []string{"http://localhost:9200"}, Timeout: 5 * time.Second},
+		Log:           Log{Level: "info"},
+		Tracing:       Tracing{Exporter: "none"},
+		Ready: Ready{
+			Timeout:          2 * time.Second,
+			HardDependencies: []string{"postgres", "redis", "elasticsearch"},
+		},
+		Languages: Languages{Default: "ru", Supported: []string{"en"}},
+		Media:     Media{Backend: "local", MaxBytes: 10 << 20, Dir: "./media-files"},
+		Reminders: Reminders{Channel: "log", Interval: time.Minute},
+		Webhooks:  Webhooks{Interval: 5 * time.Second},
+		Reconcile: Reconcile{Interval: time.Hour},
+	}
+}
+
+// Problems lists everything wrong with a config, so all of it can be fixed at once.
+type Problems []string
+
+func (p Problems) Error() string {
+	return "invalid config: " + strings.Join(p, "; ")
+}
+
+func (p *Problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// validate checks every setting, adding a problem for each one that is wrong.
+func (c *Config) validate(p *Problems) {
+	if c.HTTP.Addr == "" {
+		p.add("HTTP_ADDR is required")
+	}
+	if c.HTTP.MetricsAddr == "" {
+		p.add("METRICS_ADDR is required")
+	} else if c.HTTP.MetricsAddr == c.HTTP.Addr {
+		p.add("METRICS_ADDR must differ from HTTP_ADDR")
+	}
+	nonNegative(p, "HTTP_READ_HEADER_TIMEOUT", c.HTTP.ReadHeaderTimeout)
+	nonNegative(p, "HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout)
+	nonNegative(p, "HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout)
+	nonNegative(p, "HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout)
+	positive(p, "SHUTDOWN_TIMEOUT", c.HTTP.ShutdownTimeout)
+	if _, err := ratelimit.ParseTrustedProxies(strings.Join(c.HTTP.TrustedProxies, ",")); err != nil {
+		p.add("TRUSTED_PROXIES: %v", err)
+	}
+
+	required(p, "CLIENT_ID", c.Auth.ClientID)
+	required(p, "CLIENT_SECRET", c.Auth.ClientSecret)
+	absoluteURL(p, "REDIRECT_URL", c.Auth.RedirectURL, true)
+	absoluteURL(p, "END_REDIRECT_URL", c.Auth.EndRedirectURL, false)
+
+	absoluteURL(p, "DATABASE_URL", c.Postgres.URL, true)
+	nonNegative(p, "POSTGRES_TIMEOUT", c.Postgres.Timeout)
+	required(p, "REDIS_URL", c.Redis.Addr)
+	nonNegative(p, "REDIS_TIMEOUT", c.Redis.Timeout)
+	if len(c.Elasticsearch.Addresses) == 0 {
+		p.add("ELASTICSEARCH_URL is required")
+	}
+	for _, address := range c.Elasticsearch.Addresses {
+		absoluteURL(p, "ELASTICSEARCH_URL", address, true)
+	}
+	nonNegative(p, "ES_TIMEOUT", c.Elasticsearch.Timeout)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		p.add("LOG_LEVEL: unknown level %q", c.Log.Level)
+	}
+	oneOf(p, "TRACING_EXPORTER", c.Tracing.Exporter, "none", "otlp", "stdout")
+
+	positive(p, "READY_TIMEOUT", c.Ready.Timeout)
+	for _, name := range c.Ready.HardDependencies {
+		oneOf(p, "READY_HARD_DEPENDENCIES", name, "postgres", "redis", "elasticsearch")
+	}
+
+	if _, err := i18n.NewLanguages(c.Languages.Default, c.Languages.Supported); err != nil {
+		p.add("DEFAULT_LANG or SUPPORTED_LANGS: %v", err)
+	}
+
+	rateLimit(p, "RATE_LIMIT_SEARCH", c.RateLimits.Search)
+	rateLimit(p, "RATE_LIMIT_VOTE", c.RateLimits.Vote)
+	rateLimit(p, "RATE_LIMIT_DEFAULT", c.RateLimits.Default)
+
+	oneOf(p, "MEDIA_BACKEND", c.Media.Backend, "local", "s3")
+	if c.Media.MaxBytes <= 0 {
+		p.add("MEDIA_MAX_BYTES must be positive")
+	}
+	switch c.Media.Backend {
+	case "local":
+		required(p, "MEDIA_DIR", c.Media.Dir)
+	case "s3":
+		absoluteURL(p, "S3_ENDPOINT", c.Media.S3.Endpoint, true)
+		required(p, "S3_BUCKET", c.Media.S3.Bucket)
+		required(p, "S3_ACCESS_KEY", c.Media.S3.AccessKey)
+		required(p, "S3_SECRET_KEY", c.Media.S3.SecretKey)
+		absoluteURL(p, "S3_PUBLIC_URL", c.Media.S3.PublicURL, false)
+	}
+
+	oneOf(p, "REMINDER_CHANNEL", c.Reminders.Channel, "log", "vk")
+	if c.Reminders.Channel == "vk" {
+		required(p, "VK_GROUP_TOKEN", c.Reminders.VkGroupToken)
+	}
+	positive(p, "REMINDER_INTERVAL", c.Reminders.Interval)
+	positive(p, "WEBHOOK_INTERVAL", c.Webhooks.Interval)
+	positive(p, "RECONCILE_INTERVAL", c.Reconcile.Interval)
+}
+
+func required(p *Problems, env, value string) {
+	if value == "" {
+		p.add("%s is required", env)
+	}
+}
+
+func positive(p *Problems, env string, value time.Duration) {
+	if value <= 0 {
+		p.add("%s must be positive", env)
+	}
+}
+
+func nonNegative(p *Problems, env string, value time.Duration) {
+	if value < 0 {
+		p.add("%s must not be negative", env)
+	}
+}
+
+func oneOf(p *Problems, env, value string, allowed ...string) {
+	for _, item := range allowed {
+		if value == item {
+			return
+		}
+	}
+	p.add("%s: %q is not one of %s", env, value, strings.Join(allowed, ", "))
+}
+
+func absoluteURL(p *Problems, env, value string, isRequired bool) {
+	if value == "" {
+		if isRequired {
+			p.add("%s is required", env)
+		}
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		p.add("%s: not an absolute URL", env)
+	}
+}
+
+func rateLimit(p *Problems, env, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := ratelimit.ParseLimit(value); err != nil {
+		p.add("%s: %v", env, err)
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the defaults, then the JSON file at path unless it's empty, then the env
+// overrides, and validates the result. The returned Problems cover the file, env and
+// validation together.
+func Load(path string) (*Config, error) {
+	c := Default()
+	var problems Problems
+	if path != "" {
+		c.loadFile(path, &problems)
+	}
+	c.loadEnv(&problems)
+	c.validate(&problems)
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return &c, nil
+}
+
+// loadFile sets the keys present in the file. Values are JSON scalars, or arrays of them
+// for list settings; durations are strings like "30s".
+func (c *Config) loadFile(path string, p *Problems) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		p.add("config file: %v", err)
+		return
+	}
+	// Numbers are kept as written, so large integers survive.
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		p.add("config file %s: %v", path, err)
+		return
+	}
+	setFromFile(reflect.ValueOf(c).Elem(), values, "", p)
+}
+
+func setFromFile(section reflect.Value, values map[string]any, prefix string, p *Problems) {
+	fields := make(map[string]int, section.NumField())
+	for i := 0; i < section.NumField(); i++ {
+		fields[jsonName(section.Type().Field(i))] = i
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := values[key]
+		i, ok := fields[key]
+		if !ok {
+			p.add("%s%s: unknown key", prefix, key)
+			continue
+		}
+		field := section.Field(i)
+		if field.Kind() == reflect.Struct {
+			nested, ok := value.(map[string]any)
+			if !ok {
+				p.add("%s%s: must be an object", prefix, key)
+				continue
+			}
+			setFromFile(field, nested, prefix+key+".", p)
+			continue
+		}
+
+		var items []string
+		if list, isList := value.([]any); isList {
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+		} else if value != nil {
+			items = []string{fmt.Sprint(value)}
+		}
+		if err := setField(field, items); err != nil {
+			p.add("%s%s: %v", prefix, key, err)
+		}
+	}
+}
+
+// loadEnv sets every setting whose env var is non-empty. Lists are comma separated.
+func (c *Config) loadEnv(p *Problems) {
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) {
+		env := field.Tag.Get("env")
+		raw := os.Getenv(env)
+		if raw == "" {
+			return
+		}
+		var items []string
+		if value.Kind() == reflect.Slice {
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		} else {
+			items = []string{raw}
+		}
+		if err := setField(value, items); err != nil {
+			p.add("%s: %v", env, err)
+		}
+	})
+}
+
+// setField parses items into a setting: all of them for a list, the only one otherwise.
+func setField(field reflect.Value, items []string) error {
+	if field.Kind() == reflect.Slice {
+		list := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setScalar(list.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(list)
+		return nil
+	}
+	if len(items) != 1 {
+		return fmt.Errorf("expected a single value")
+	}
+	return setScalar(field, items[0])
+}
+
+func setScalar(field reflect.Value, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		field.SetInt(int64(value))
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+	case field.Kind() == reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(value)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// Redacted returns the effective config for printing, keyed like the config file,
+// with secrets hidden and durations written as in the file.
+func (c *Config) Redacted() map[string]any {
+	return redactSection(reflect.ValueOf(c).Elem())
+}
+
+func redactSection(section reflect.Value) map[string]any {
+	out := make(map[string]any, section.NumField())
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Type().Field(i)
+		value := section.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			out[jsonName(field)] = redactSection(value)
+		case value.Type() == durationType:
+			out[jsonName(field)] = time.Duration(value.Int()).String()
+		case field.Tag.Get("secret") == "true" && value.String() != "":
+			out[jsonName(field)] = "[redacted]"
+		case field.Tag.Get("secret") == "url":
+			out[jsonName(field)] = redactURL(value.String())
+		default:
+			out[jsonName(field)] = value.Interface()
+		}
+	}
+	return out
+}
+
+// redactURL hides the password of a connection URL.
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "[redacted]"
+	}
+	return parsed.Redacted()
+}
+
+// walk calls fn for every setting, descending into sections.
+func walk(section reflect.Value, fn func(field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Type().Field(i)
+		if section.Field(i).Kind() == reflect.Struct {
+			walk(section.Field(i), fn)
+			continue
+		}
+		fn(field, section.Field(i))
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
@@ -1,46 +1,56 @@
 package controllers
 
 import (
+	"TaskService/config"
+	"TaskService/i18n"
+	"TaskService/logging"
 	"TaskService/models/cache"
+	"TaskService/problem"
 	"TaskService/storages"
-	"context"
 	"encoding/json"
 	"github.com/go-vk-api/vk"
 	"github.com/gorilla/mux"
 	"golang.org/x/oauth2"
 	oauthVk "golang.org/x/oauth2/vk"
-	"log"
 	"net/http"
-	"os"
 )
 
 type AccountController struct {
-	logger         *log.Logger
 	conf           *oauth2.Config
 	sessionStor    *storages.SessionStorage
+	postStor       *storages.PostStorage
+	bookmarkStor   *storages.BookmarkStorage
+	decorator      postDecorator
 	endRedirectURL string
 }
 
 var tokens map[string]oauth2.Token
 
-func NewAccountController(logger *log.Logger, sessionStor *storages.SessionStorage) *AccountController {
-	//tokenURL := os.Getenv("VK_TOKEN")
-
+func NewAccountController(sessionStor *storages.SessionStorage,
+	postStor *storages.PostStorage, bookmarkStor *storages.BookmarkStorage,
+	userPostRatingStor *storages.UserPostRatingStorage, mediaStor *storages.MediaStorage,
+	translationStor *storages.TranslationStorage, langs *i18n.Languages, auth config.Auth) *AccountController {
 	conf := &oauth2.Config{
-		ClientID:     os.Getenv("CLIENT_ID"),
-		ClientSecret: os.Getenv("CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("REDIRECT_URL"),
+		ClientID:     auth.ClientID,
+		ClientSecret: auth.ClientSecret,
+		RedirectURL:  auth.RedirectURL,
 		Scopes:       []string{},
 		Endpoint:     oauthVk.Endpoint,
 	}
 
-	endRedirectURL := os.Getenv("END_REDIRECT_URL")
-
 	return &AccountController{
-		logger:         logger,
-		conf:           conf,
-		sessionStor:    sessionStor,
-		endRedirectURL: endRedirectURL,
+		conf:         conf,
+		sessionStor:  sessionStor,
+		postStor:     postStor,
+		bookmarkStor: bookmarkStor,
+		decorator: postDecorator{
+			mediaStor:          mediaStor,
+			translationStor:    translationStor,
+			langs:              langs,
+			bookmarkStor:       bookmarkStor,
+			userPostRatingStor: userPostRatingStor,
+		},
+		endRedirectURL: auth.EndRedirectURL,
 	}
 }
 
@@ -49,76 +59,79 @@ func (c *AccountController) Register(basePath string, router *mux.Router) {
 	router.HandleFunc(basePath+"/logout", c.LogOut).Methods("POST")
 	router.HandleFunc(basePath+"/url", c.GetUrl).Methods("GET")
 	router.HandleFunc(basePath+"/verify", c.Verify)
+	router.HandleFunc(basePath+"/bookmarks", c.GetBookmarks).Methods("GET")
 }
 
 type logDTO struct {
-	SessionToken string `json:"sessionToken"`
+	SessionToken string `json:"sessionToken" validate:"required"`
 }
 
 func (c *AccountController) LogIn(w http.ResponseWriter, r *http.Request) {
-	logDto, err := c.getLogDto(w, r)
-	if err != nil {
+	logger := logging.FromContext(r.Context())
+	logDto, ok := c.getLogDto(w, r)
+	if !ok {
 		return
 	}
 
-	userVk, err := c.sessionStor.GetSession(logDto.SessionToken)
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: logDto.SessionToken}, w)
 	if err != nil {
-		c.logger.Println("Can't get session, Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
 		return
 	}
 	if err := json.NewEncoder(w).Encode(userVk.Info); err != nil {
-		c.logger.Println("Error encoding userInfo, \nuserVk: ", userVk, "\nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error encoding userInfo", "user", userVk.Info.Id, "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
 
 func (c *AccountController) LogOut(w http.ResponseWriter, r *http.Request) {
-	logDto, err := c.getLogDto(w, r)
-	if err != nil {
+	logger := logging.FromContext(r.Context())
+	logDto, ok := c.getLogDto(w, r)
+	if !ok {
 		return
 	}
 
-	if err := c.sessionStor.DeleteSession(logDto.SessionToken); err != nil {
-		c.logger.Println("Error deleting session, token: ", logDto.SessionToken, "\nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+	if _, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: logDto.SessionToken}, w); err != nil {
+		return
+	}
+	if err := c.sessionStor.DeleteSession(r.Context(), logDto.SessionToken); err != nil {
+		logger.Error("error deleting session", "token", logging.Redact(logDto.SessionToken), "err", err)
+		writeError(w, err)
 		return
 	}
 }
 
 func (c *AccountController) Verify(w http.ResponseWriter, r *http.Request) {
-	c.logger.Println("Verify() url: ", r.URL)
+	logger := logging.FromContext(r.Context())
 	queryCode := r.URL.Query()["code"]
 	if len(queryCode) < 1 {
-		c.logger.Println("Invalid code param: ", queryCode)
-		http.Error(w, "Invalid code param", http.StatusBadRequest)
+		logger.Warn("invalid code param")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Invalid code param")
 		return
 	}
 	code := queryCode[0]
-	ctx := context.Background()
-	token, err := c.conf.Exchange(ctx, code)
+	token, err := c.conf.Exchange(r.Context(), code)
 	if err != nil {
-		c.logger.Println("Error exchanging token, Code: ", code, "Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error exchanging token", "err", err)
+		writeError(w, err)
 		return
 	}
 
-	c.logger.Println("Token: ", token)
+	logger.Debug("exchanged oauth token", "accessToken", logging.Redact(token.AccessToken), "expiry", token.Expiry)
 	client, err := vk.NewClientWithOptions(vk.WithToken(token.AccessToken))
 	if err != nil {
-		c.logger.Println("Error creating vk client, Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error creating vk client", "err", err)
+		writeError(w, err)
 		return
 	}
 
 	user, err := getCurrentUser(client)
 	if err != nil {
-		c.logger.Println("Error")
-		http.Error(w, "Error", http.StatusInternalServerError)
+		logger.Error("error getting vk user", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
-	c.logger.Println("User: ", user)
+	logger.Debug("got vk user", "id", user.ID)
 
 	/*http.SetCookie(w, &http.Cookie{
 		Name:    "session_token",
@@ -135,16 +148,59 @@ func (c *AccountController) Verify(w http.ResponseWriter, r *http.Request) {
 			Photo:      user.Photo,
 		},
 	}
-	sessionToken, err := c.sessionStor.CreateSession(userVk)
+	sessionToken, err := c.sessionStor.CreateSession(r.Context(), userVk)
 	if err != nil {
-		c.logger.Println("Error creating session, Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error creating session", "err", err)
+		writeError(w, err)
 		return
 	}
 
 	http.Redirect(w, r, c.endRedirectURL+"?sessionToken="+sessionToken, http.StatusSeeOther)
 }
 
+func (c *AccountController) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+
+	size, page, err := getPageParams(w, r)
+	if err != nil {
+		return
+	}
+
+	ids, total, err := c.bookmarkStor.GetPostIds(r.Context(), userVk.Info.Id, size, page)
+	if err != nil {
+		logger.Error("error getting bookmarks", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+
+	posts, err := c.postStor.GetMany(r.Context(), ids)
+	if err != nil {
+		logger.Error("error getting many posts by ids", "err", err)
+		writeError(w, err)
+		return
+	}
+	posts = orderPostsByIds(posts, ids)
+	if err := c.decorator.decorate(w, r, userVk, posts); err != nil {
+		logger.Error("error decorating posts", "err", err)
+		writeError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"total": total,
+		"posts": posts,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("error encoding posts", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
 type User struct {
 	ID         int64  `json:"id"`
 	Name       string `json:"name"`
@@ -153,14 +209,15 @@ type User struct {
 }
 
 func (c *AccountController) GetUrl(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	url := c.conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-	c.logger.Println("Generated url in Authenricate(), \nURL: ", url)
+	logger.Debug("generated url", "url", url)
 	resp := struct {
 		Url string `json:"url"`
 	}{Url: url}
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		c.logger.Println("Error encoding url in Authenticate(), \nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error encoding url", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
@@ -177,12 +234,10 @@ func getCurrentUser(api *vk.Client) (*User, error) {
 	return &users[0], nil
 }
 
-func (c *AccountController) getLogDto(w http.ResponseWriter, r *http.Request) (*logDTO, error) {
-	var logDto *logDTO
-	if err := json.NewDecoder(r.Body).Decode(logDto); err != nil {
-		c.logger.Println("Error decoding logDto in LogIn(), Error: ", err.Error())
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return nil, err
+func (c *AccountController) getLogDto(w http.ResponseWriter, r *http.Request) (*logDTO, bool) {
+	logDto := &logDTO{}
+	if !decodeBody(w, r, logDto) {
+		return nil, false
 	}
-	return logDto, nil
+	return logDto, true
 }
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/models"
+	"TaskService/problem"
+	"TaskService/storages"
+	"TaskService/validation"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// ChecklistController serves onboarding checklists. Editors manage the checklists
+// and their items, every signed in user ticks items off and tracks their own progress.
+type ChecklistController struct {
+	checklistStor *storages.ChecklistStorage
+	postStor      *storages.PostStorage
+	sessionStor   *storages.SessionStorage
+	editors       map[int64]bool
+}
+
+func NewChecklistController(checklistStor *storages.ChecklistStorage, postStor *storages.PostStorage,
+	sessionStor *storages.SessionStorage, editors map[int64]bool) *ChecklistController {
+	return &ChecklistController{
+		checklistStor: checklistStor,
+		postStor:      postStor,
+		sessionStor:   sessionStor,
+		editors:       editors,
+	}
+}
+
+func (c *ChecklistController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath, c.GetChecklists).Methods("GET")
+	router.HandleFunc(basePath, c.AddChecklist).Methods("POST")
+	router.HandleFunc(basePath+"/{id}", c.GetChecklist).Methods("GET")
+	router.HandleFunc(basePath+"/{id}", c.UpdateChecklist).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}", c.DeleteChecklist).Methods("DELETE")
+	router.HandleFunc(basePath+"/{id}/progress", c.GetProgress).Methods("GET")
+	router.HandleFunc(basePath+"/{id}/items", c.AddItem).Methods("POST")
+	router.HandleFunc(basePath+"/{id}/items/{itemId}", c.UpdateItem).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}/items/{itemId}", c.DeleteItem).Methods("DELETE")
+	router.HandleFunc(basePath+"/{id}/items/{itemId}/done", c.setDone(true)).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}/items/{itemId}/done", c.setDone(false)).Methods("DELETE")
+}
+
+func (c *ChecklistController) GetChecklists(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	checklists, err := c.checklistStor.GetAll(r.Context())
+	if err != nil {
+		logger.Error("error getting checklists", "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(checklists); err != nil {
+		logger.Error("error encoding checklists", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+// GetChecklist returns the checklist with its items, marking the caller's done items when signed in.
+func (c *ChecklistController) GetChecklist(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	checklist, err := c.checklistStor.GetOne(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistNotFound, "")
+		return
+	}
+	if err != nil {
+		logger.Error("error getting checklist", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if userVk := getOptionalSession(c.sessionStor, r); userVk != nil {
+		if err := c.checklistStor.FillDone(r.Context(), userVk.Info.Id, checklist.Items); err != nil {
+			logger.Error("error getting progress", "id", id, "err", err)
+			writeError(w, err)
+			return
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(checklist); err != nil {
+		logger.Error("error encoding checklist", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *ChecklistController) AddChecklist(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	checklistDto, ok := c.decodeChecklist(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := c.checklistStor.Create(r.Context(), checklistDto)
+	if err != nil {
+		logger.Error("error creating checklist", "err", err)
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(struct {
+		Id string `json:"id"`
+	}{Id: id}); err != nil {
+		logger.Error("error encoding id", "err", err)
+		return
+	}
+}
+
+func (c *ChecklistController) UpdateChecklist(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	checklistDto, ok := c.decodeChecklist(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := c.checklistStor.Update(r.Context(), id, checklistDto)
+	if err != nil {
+		logger.Error("error updating checklist", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !updated {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistNotFound, "")
+		return
+	}
+}
+
+func (c *ChecklistController) DeleteChecklist(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	deleted, err := c.checklistStor.Delete(r.Context(), id)
+	if err != nil {
+		logger.Error("error deleting checklist", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !deleted {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistNotFound, "")
+		return
+	}
+}
+
+func (c *ChecklistController) AddItem(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	itemDto, ok := c.decodeItem(w, r)
+	if !ok {
+		return
+	}
+	if _, err := c.checklistStor.GetOne(r.Context(), id); err != nil {
+		writeLookupError(w, err, problem.ChecklistNotFound)
+		return
+	}
+
+	itemId, err := c.checklistStor.CreateItem(r.Context(), id, itemDto)
+	if err != nil {
+		logger.Error("error creating item", "checklist", id, "err", err)
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(struct {
+		Id string `json:"id"`
+	}{Id: itemId}); err != nil {
+		logger.Error("error encoding id", "err", err)
+		return
+	}
+}
+
+func (c *ChecklistController) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	itemId, ok := getUuidVar(w, r, "itemId")
+	if !ok {
+		return
+	}
+	itemDto, ok := c.decodeItem(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := c.checklistStor.UpdateItem(r.Context(), id, itemId, itemDto)
+	if err != nil {
+		logger.Error("error updating item", "item", itemId, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !updated {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistItemNotFound, "")
+		return
+	}
+}
+
+func (c *ChecklistController) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	itemId, ok := getUuidVar(w, r, "itemId")
+	if !ok {
+		return
+	}
+
+	deleted, err := c.checklistStor.DeleteItem(r.Context(), id, itemId)
+	if err != nil {
+		logger.Error("error deleting item", "item", itemId, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !deleted {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistItemNotFound, "")
+		return
+	}
+}
+
+// setDone returns the handler ticking an item off for the caller (done) or unticking it.
+// Both are idempotent.
+func (c *ChecklistController) setDone(done bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+		userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+		if err != nil {
+			return
+		}
+		id, ok := getUuidVar(w, r, "id")
+		if !ok {
+			return
+		}
+		itemId, ok := getUuidVar(w, r, "itemId")
+		if !ok {
+			return
+		}
+
+		exists, err := c.checklistStor.SetItemDone(r.Context(), userVk.Info.Id, id, itemId, done)
+		if err != nil {
+			logger.Error("error setting item done", "item", itemId, "err", err)
+			writeError(w, err)
+			return
+		}
+		if !exists {
+			writeProblem(w, http.StatusNotFound, problem.ChecklistItemNotFound, "")
+			return
+		}
+		c.writeProgress(w, r, userVk.Info.Id, id)
+	}
+}
+
+// GetProgress returns the caller's completion of the checklist with the state of every item.
+func (c *ChecklistController) GetProgress(w http.ResponseWriter, r *http.Request) {
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	c.writeProgress(w, r, userVk.Info.Id, id)
+}
+
+func (c *ChecklistController) writeProgress(w http.ResponseWriter, r *http.Request, userId int64, id string) {
+	logger := logging.FromContext(r.Context())
+	progress, err := c.checklistStor.GetProgress(r.Context(), userId, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.ChecklistNotFound, "")
+		return
+	}
+	if err != nil {
+		logger.Error("error getting progress", "checklist", id, "user", userId, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		logger.Error("error encoding progress", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *ChecklistController) decodeChecklist(w http.ResponseWriter, r *http.Request) (*models.ChecklistDTO, bool) {
+	var checklistDto models.ChecklistDTO
+	if !decodeBody(w, r, &checklistDto) {
+		return nil, false
+	}
+	return &checklistDto, true
+}
+
+// decodeItem reads an item and checks that the post it links to exists.
+func (c *ChecklistController) decodeItem(w http.ResponseWriter, r *http.Request) (*models.ChecklistItemDTO, bool) {
+	logger := logging.FromContext(r.Context())
+	var itemDto models.ChecklistItemDTO
+	if !decodeBody(w, r, &itemDto) {
+		return nil, false
+	}
+	if itemDto.PostId != nil {
+		if _, err := c.postStor.GetOne(r.Context(), *itemDto.PostId); err != nil {
+			logger.Warn("unknown linked post", "postId", *itemDto.PostId, "err", err)
+			writeViolations(w, validation.Errors{"postId": "does not exist"})
+			return nil, false
+		}
+	}
+	return &itemDto, true
+}
+
+// getUuidVar reads a uuid path variable, answering 400 when it is malformed.
+func getUuidVar(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	value := mux.Vars(r)[name]
+	if _, err := uuid.Parse(value); err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, name+" incorrect")
+		return "", false
+	}
+	return value, true
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"TaskService/i18n"
+	"TaskService/logging"
+	"TaskService/models"
+	"TaskService/models/cache"
+	"TaskService/problem"
+	"TaskService/storages"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const sessionTokenHeader = "X-Session-Token"
+
+type TokenDTO struct {
+	SessionToken string `json:"sessionToken"`
+}
+
+// sessionTokenFromRequest reads the session token of requests without a body,
+// first from the X-Session-Token header, then from the sessionToken query param.
+func sessionTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("sessionToken")
+}
+
+func tryGetSession(ctx context.Context, sessionStor *storages.SessionStorage, tokenDto *TokenDTO, w http.ResponseWriter) (*cache.UserVk, error) {
+	logger := logging.FromContext(ctx)
+	if tokenDto.SessionToken == "" {
+		logger.Warn("got no token")
+		writeProblem(w, http.StatusUnauthorized, problem.SessionRequired, "Got no sessionToken")
+		return nil, errors.New("no token")
+	}
+
+	userVk, err := sessionStor.GetSession(ctx, tokenDto.SessionToken)
+	if err != nil && !errors.Is(err, storages.ErrSessionNotFound) {
+		logger.Error("error getting session", "err", err)
+		writeError(w, err)
+		return nil, err
+	}
+	if err != nil || !userVk.Valid() {
+		logger.Warn("expired token", "token", logging.Redact(tokenDto.SessionToken), "err", err)
+		writeProblem(w, http.StatusUnauthorized, problem.SessionExpired, "Token expired")
+		return nil, errors.New("token expired")
+	}
+
+	return userVk, nil
+}
+
+// getOptionalSession returns the caller's session for endpoints that also serve anonymous users.
+// A missing or expired token yields nil without writing a response.
+func getOptionalSession(sessionStor *storages.SessionStorage, r *http.Request) *cache.UserVk {
+	token := sessionTokenFromRequest(r)
+	if token == "" {
+		return nil
+	}
+	userVk, err := sessionStor.GetSession(r.Context(), token)
+	if err != nil || !userVk.Valid() {
+		return nil
+	}
+	return userVk
+}
+
+func getPageParams(w http.ResponseWriter, r *http.Request) (size int, page int, err error) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+	pageQuery, ok := query["page"]
+	if !ok || len(pageQuery) < 1 {
+		logger.Warn("has no page in query")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Has no page in query")
+		return 0, 0, errors.New("no page")
+	}
+	sizeQuery, ok := query["size"]
+	if !ok || len(sizeQuery) < 1 {
+		logger.Warn("has no size in query")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Has no size in query")
+		return 0, 0, errors.New("no size")
+	}
+	page, err = strconv.Atoi(pageQuery[0])
+	if err != nil {
+		logger.Warn("page is not integer")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Page is not integer")
+		return 0, 0, errors.New("page is not int")
+	}
+	if page < 1 {
+		logger.Warn("page is less than 1")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Page is less than 1")
+		return 0, 0, errors.New("page is less than 1")
+	}
+
+	size, err = strconv.Atoi(sizeQuery[0])
+	if err != nil {
+		logger.Warn("size is not integer")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Size is not integer")
+		return 0, 0, errors.New("size is not int")
+	}
+	if size < 1 {
+		logger.Warn("size is less than 1")
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Size is less than 1")
+		return 0, 0, errors.New("size is less than 1")
+	}
+
+	return size, page, nil
+}
+
+// orderPostsByIds returns posts in the order of ids, since "id = ANY(...)" queries don't keep it.
+func orderPostsByIds(posts []models.Post, ids []string) []models.Post {
+	byId := make(map[string]models.Post, len(posts))
+	for _, post := range posts {
+		byId[post.Id] = post
+	}
+	ordered := make([]models.Post, 0, len(posts))
+	for _, id := range ids {
+		if post, ok := byId[id]; ok {
+			ordered = append(ordered, post)
+		}
+	}
+	return ordered
+}
+
+// tryGetPrivileged authenticates the caller by the header or query session token and
+// checks that the VK user is in the allowed set, e.g. admins or editors.
+func tryGetPrivileged(sessionStor *storages.SessionStorage, allowed map[int64]bool,
+	w http.ResponseWriter, r *http.Request) (*cache.UserVk, error) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed[userVk.Info.Id] {
+		logger.Warn("forbidden privileged request", "user", userVk.Info.Id)
+		writeProblem(w, http.StatusForbidden, problem.Forbidden, "")
+		return nil, errors.New("not privileged")
+	}
+	return userVk, nil
+}
+
+// postDecorator fills the fields of posts that aren't stored with them. Every endpoint
+// returning posts uses it, so a post reads the same wherever it comes from.
+type postDecorator struct {
+	mediaStor          *storages.MediaStorage
+	translationStor    *storages.TranslationStorage
+	langs              *i18n.Languages
+	bookmarkStor       *storages.BookmarkStorage
+	userPostRatingStor *storages.UserPostRatingStorage
+}
+
+// decorate fills the media URLs of posts, translates them into the request language and,
+// when userVk is known, the per-user fields. The language is negotiated, so w varies on it.
+func (d *postDecorator) decorate(w http.ResponseWriter, r *http.Request, userVk *cache.UserVk, posts []models.Post) error {
+	if err := attachMedia(r.Context(), d.mediaStor, posts); err != nil {
+		return err
+	}
+	if err := localizePosts(r.Context(), d.translationStor, d.langs, d.langs.Pick(w, r), posts); err != nil {
+		return err
+	}
+	if userVk == nil || len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+
+	bookmarked, err := d.bookmarkStor.GetBookmarked(r.Context(), userVk.Info.Id, ids)
+	if err != nil {
+		return err
+	}
+	opers, err := d.userPostRatingStor.GetUserOpers(r.Context(), userVk.Info.Id, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		isBookmarked := bookmarked[posts[i].Id]
+		posts[i].IsBookmarked = &isBookmarked
+		myVote := d.userPostRatingStor.OperToDelta(opers[posts[i].Id])
+		posts[i].MyVote = &myVote
+	}
+
+	return nil
+}
+
+// attachMedia fills the image URLs of posts referencing uploaded media with one query.
+func attachMedia(ctx context.Context, mediaStor *storages.MediaStorage, posts []models.Post) error {
+	var ids []string
+	for _, post := range posts {
+		if post.MediaId != nil {
+			ids = append(ids, *post.MediaId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	urls, err := mediaStor.GetUrls(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		if posts[i].MediaId != nil {
+			posts[i].Media = urls[*posts[i].MediaId]
+		}
+	}
+	return nil
+}
+
+// localizePosts replaces title and content with their lang translation where one
+// exists, with one query for all posts. The rest stay in the default language.
+func localizePosts(ctx context.Context, translationStor *storages.TranslationStorage, langs *i18n.Languages, lang string, posts []models.Post) error {
+	for i := range posts {
+		posts[i].Lang = langs.Default
+	}
+	if lang == langs.Default || len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	translations, err := translationStor.GetMany(ctx, ids, lang)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		translation, ok := translations[posts[i].Id]
+		if !ok {
+			continue
+		}
+		posts[i].Title = translation.Title
+		posts[i].Content = translation.Content
+		posts[i].ContentHtml = translation.ContentHtml
+		posts[i].Lang = lang
+	}
+	return nil
+}
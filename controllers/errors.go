@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/problem"
+	"TaskService/storages"
+	"TaskService/validation"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// writeProblem responds with the problem of code, e.g. for an invalid param.
+func writeProblem(w http.ResponseWriter, status int, code problem.Code, detail string) {
+	problem.New(status, code, detail).Write(w)
+}
+
+// writeError is the one place where storage and domain errors become problems:
+// broken vote and moderation rules get their own codes, a missing session is expired,
+// a datastore running out of time is a timeout and anything else an internal error.
+func writeError(w http.ResponseWriter, err error) {
+	var doubleOper *storages.DoubleOperError
+	var invalidOper *storages.InvalidOperError
+	switch {
+	case errors.As(err, &doubleOper):
+		writeProblem(w, http.StatusConflict, problem.VoteDuplicate, "The post already has this vote")
+	case errors.As(err, &invalidOper):
+		writeProblem(w, http.StatusBadRequest, problem.VoteInvalid, invalidOper.Error())
+	case errors.Is(err, storages.ErrFlagReviewed):
+		writeProblem(w, http.StatusConflict, problem.FlagReviewed, err.Error())
+	case errors.Is(err, storages.ErrSessionNotFound):
+		writeProblem(w, http.StatusUnauthorized, problem.SessionExpired, "Token expired")
+	case storages.IsTimeout(err):
+		writeProblem(w, http.StatusGatewayTimeout, problem.Timeout, "")
+	default:
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+	}
+}
+
+// writeLookupError is writeError for a storage call looking something up, whose
+// missing row is reported with notFound, as only the caller knows what it looked for.
+func writeLookupError(w http.ResponseWriter, err error, notFound problem.Code) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, notFound, "")
+		return
+	}
+	writeError(w, err)
+}
+
+// decodeBody decodes the JSON body into dto and validates it against its validate tags.
+// It responds with invalid_body when the body isn't a JSON object and with every field
+// violation at once otherwise, returning false in both cases.
+func decodeBody(w http.ResponseWriter, r *http.Request, dto any) bool {
+	violations, err := validation.Decode(r.Body, dto)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("error decoding body", "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.InvalidBody, "Invalid body")
+		return false
+	}
+	if len(violations) > 0 {
+		writeViolations(w, violations)
+		return false
+	}
+	return true
+}
+
+// writeViolations responds with validation_failed listing what's wrong with each field.
+func writeViolations(w http.ResponseWriter, violations validation.Errors) {
+	p := problem.New(http.StatusBadRequest, problem.ValidationFailed, "Some fields are invalid")
+	p.Errors = violations
+	p.Write(w)
+}
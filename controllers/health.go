@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"TaskService/health"
+	"TaskService/logging"
+	"TaskService/models"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{
+		checker: checker,
+	}
+}
+
+func (c *HealthController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath+"/healthz", c.Healthz).Methods("GET")
+	router.HandleFunc(basePath+"/readyz", c.Readyz).Methods("GET")
+}
+
+// Healthz reports that the process is alive and serving, without touching dependencies.
+func (c *HealthController) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": models.HealthUp}); err != nil {
+		logging.FromContext(r.Context()).Error("error encoding health", "err", err)
+	}
+}
+
+// Readyz pings every dependency and responds 503 when a hard one is down.
+func (c *HealthController) Readyz(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	readiness := c.checker.Check(r.Context())
+
+	w.Header().Set("Cache-Control", "no-store")
+	if readiness.Status != models.ReadinessReady {
+		logger.Warn("not ready", "dependencies", readiness.Dependencies)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(readiness); err != nil {
+		logger.Error("error encoding readiness", "err", err)
+	}
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"TaskService/live"
+	"TaskService/logging"
+	"TaskService/problem"
+	"TaskService/ratelimit"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsReadLimit  = 4096
+)
+
+// LiveController streams rating changes over WebSocket. Clients pass the initial posts
+// in ?ids=a,b and change them with {"action": "subscribe"|"unsubscribe", "ids": [...]}
+// messages; they receive {"id", "rating"} events.
+type LiveController struct {
+	hub            *live.RatingHub
+	trustedProxies []*net.IPNet
+	upgrader       websocket.Upgrader
+}
+
+func NewLiveController(hub *live.RatingHub, trustedProxies []*net.IPNet) *LiveController {
+	return &LiveController{
+		hub:            hub,
+		trustedProxies: trustedProxies,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Ratings are public and the API allows any origin.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+func (c *LiveController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath+"/ratings", c.Ratings).Methods("GET")
+}
+
+type liveCommand struct {
+	Action string   `json:"action"`
+	Ids    []string `json:"ids"`
+}
+
+type liveError struct {
+	Error string `json:"error"`
+}
+
+func (c *LiveController) Ratings(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	var ids []string
+	if query := r.URL.Query().Get("ids"); query != "" {
+		ids = strings.Split(query, ",")
+	}
+	if err := validatePostIds(ids); err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, err.Error())
+		return
+	}
+
+	sub, err := c.hub.Connect(ratelimit.ClientIP(r, c.trustedProxies))
+	if err != nil {
+		writeProblem(w, http.StatusServiceUnavailable, problem.Unavailable, err.Error())
+		return
+	}
+	defer sub.Close()
+	if err := sub.Watch(ids); err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, err.Error())
+		return
+	}
+
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered already.
+		logger.Error("error upgrading", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	replies := make(chan interface{}, 8)
+	readerDone := make(chan struct{})
+	go c.readCommands(logger, conn, sub, replies, readerDone)
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-sub.Ready():
+			for _, event := range sub.Take() {
+				if !c.write(logger, conn, event) {
+					return
+				}
+			}
+		case reply := <-replies:
+			if !c.write(logger, conn, reply) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-readerDone:
+			return
+		case <-c.hub.Stopped():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// readCommands applies the client's commands until the connection fails or the client
+// stops answering pings. Only the handler goroutine writes, so replies go through a channel.
+func (c *LiveController) readCommands(logger *slog.Logger, conn *websocket.Conn, sub *live.Subscriber, replies chan<- interface{},
+	done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(wsReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var command liveCommand
+		if err := conn.ReadJSON(&command); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				logger.Error("error reading live command", "err", err)
+			}
+			return
+		}
+
+		var err error
+		if err = validatePostIds(command.Ids); err == nil {
+			switch command.Action {
+			case "subscribe":
+				err = sub.Watch(command.Ids)
+			case "unsubscribe":
+				sub.Unwatch(command.Ids)
+			default:
+				err = errors.New("action must be subscribe or unsubscribe")
+			}
+		}
+		if err == nil {
+			continue
+		}
+		select {
+		case replies <- liveError{Error: err.Error()}:
+		default:
+			// A client flooding us with bad commands isn't reading the replies either.
+			return
+		}
+	}
+}
+
+func (c *LiveController) write(logger *slog.Logger, conn *websocket.Conn, message interface{}) bool {
+	_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(message); err != nil {
+		logger.Error("error writing live message", "err", err)
+		return false
+	}
+	return true
+}
+
+func validatePostIds(ids []string) error {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return errors.New("id incorrect: " + id)
+		}
+	}
+	return nil
+}
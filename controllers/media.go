@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/media"
+	"TaskService/models"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+type MediaController struct {
+	mediaStor   *storages.MediaStorage
+	sessionStor *storages.SessionStorage
+	maxBytes    int64
+}
+
+func NewMediaController(mediaStor *storages.MediaStorage,
+	sessionStor *storages.SessionStorage, maxBytes int64) *MediaController {
+	return &MediaController{
+		mediaStor:   mediaStor,
+		sessionStor: sessionStor,
+		maxBytes:    maxBytes,
+	}
+}
+
+func (c *MediaController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath, c.Upload).Methods("POST")
+	router.HandleFunc(basePath+"/{id}", c.GetMedia).Methods("GET")
+}
+
+// Upload accepts a multipart form with the image in the "file" field. The type is
+// sniffed from the content, and the original is stored with resized thumbnails.
+func (c *MediaController) Upload(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, c.maxBytes+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, http.StatusRequestEntityTooLarge, problem.PayloadTooLarge, "File is too large")
+			return
+		}
+		logger.Error("error reading file", "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Expected multipart form with a file field")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > c.maxBytes {
+		logger.Warn("too large file", "size", header.Size)
+		writeProblem(w, http.StatusRequestEntityTooLarge, problem.PayloadTooLarge, "File is too large")
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, c.maxBytes+1))
+	if err != nil {
+		logger.Error("error reading file", "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Invalid file")
+		return
+	}
+	if int64(len(data)) > c.maxBytes {
+		writeProblem(w, http.StatusRequestEntityTooLarge, problem.PayloadTooLarge, "File is too large")
+		return
+	}
+
+	contentType, err := media.SniffType(data)
+	if err != nil {
+		logger.Warn("unsupported media", "type", contentType)
+		writeProblem(w, http.StatusUnsupportedMediaType, problem.UnsupportedMediaType, "Unsupported media type: "+contentType)
+		return
+	}
+
+	renditions, err := media.Render(data, contentType)
+	if errors.Is(err, media.ErrTooManyPixels) {
+		logger.Warn("image too large", "err", err)
+		writeProblem(w, http.StatusRequestEntityTooLarge, problem.PayloadTooLarge, "Image has too many pixels")
+		return
+	}
+	if err != nil {
+		logger.Warn("error decoding image", "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Invalid image")
+		return
+	}
+
+	item := &models.Media{
+		Id:          uuid.New().String(),
+		ContentType: contentType,
+		Width:       renditions[0].Width,
+		Height:      renditions[0].Height,
+		Size:        int64(len(data)),
+		UploadedBy:  userVk.Info.Id,
+	}
+	if err := c.mediaStor.Create(r.Context(), item, renditions); err != nil {
+		logger.Error("error storing media", "err", err)
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		logger.Error("error encoding media", "err", err)
+		return
+	}
+}
+
+func (c *MediaController) GetMedia(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "id incorrect")
+		return
+	}
+
+	item, err := c.mediaStor.GetOne(r.Context(), id)
+	if err != nil {
+		logger.Error("error getting media", "id", id, "err", err)
+		writeLookupError(w, err, problem.MediaNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		logger.Error("error encoding media", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"TaskService/live"
+	"TaskService/logging"
+	"TaskService/models"
+	"TaskService/notify"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+)
+
+type ModerationController struct {
+	sessionStor        *storages.SessionStorage
+	userPostRatingStor *storages.UserPostRatingStorage
+	postStor           *storages.PostStorage
+	admins             map[int64]bool
+	notifier           *notify.Notifier
+	ratingHub          *live.RatingHub
+}
+
+func NewModerationController(sessionStor *storages.SessionStorage,
+	userPostRatingStor *storages.UserPostRatingStorage, postStor *storages.PostStorage,
+	admins map[int64]bool, notifier *notify.Notifier, ratingHub *live.RatingHub) *ModerationController {
+	return &ModerationController{
+		sessionStor:        sessionStor,
+		userPostRatingStor: userPostRatingStor,
+		postStor:           postStor,
+		admins:             admins,
+		notifier:           notifier,
+		ratingHub:          ratingHub,
+	}
+}
+
+func (c *ModerationController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath+"/votes/flags", c.GetFlags).Methods("GET")
+	router.HandleFunc(basePath+"/votes/flags/{id}/approve", c.ApproveFlag).Methods("POST")
+	router.HandleFunc(basePath+"/votes/flags/{id}/void", c.VoidFlag).Methods("POST")
+}
+
+func (c *ModerationController) GetFlags(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+
+	size, page, err := getPageParams(w, r)
+	if err != nil {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.VoteFlagPending
+	}
+	if status != models.VoteFlagPending && status != models.VoteFlagApproved && status != models.VoteFlagVoided {
+		logger.Warn("invalid status", "status", status)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Status must be one of pending, approved, voided")
+		return
+	}
+
+	flags, total, err := c.userPostRatingStor.GetFlags(r.Context(), status, size, page)
+	if err != nil {
+		logger.Error("error getting flags", "err", err)
+		writeError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"total": total,
+		"flags": flags,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("error encoding flags", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *ModerationController) ApproveFlag(w http.ResponseWriter, r *http.Request) {
+	c.reviewFlag(true, w, r)
+}
+
+func (c *ModerationController) VoidFlag(w http.ResponseWriter, r *http.Request) {
+	c.reviewFlag(false, w, r)
+}
+
+func (c *ModerationController) reviewFlag(approve bool, w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	admin, err := tryGetPrivileged(c.sessionStor, c.admins, w, r)
+	if err != nil {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		logger.Warn("error parsing flag id", "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "id incorrect")
+		return
+	}
+
+	flag, rating, err := c.userPostRatingStor.ReviewFlag(r.Context(), id, approve, admin.Info.Id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeProblem(w, http.StatusNotFound, problem.FlagNotFound, "")
+			return
+		}
+		if errors.Is(err, storages.ErrFlagReviewed) {
+			writeError(w, err)
+			return
+		}
+		logger.Error("error reviewing flag", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	logger.Info("flag reviewed", "id", id, "status", flag.Status, "moderator", admin.Info.Id)
+
+	if err := c.notifier.VoteReviewed(r.Context(), flag); err != nil {
+		logger.Error("error notifying voter", "flag", id, "err", err)
+	}
+
+	if rating != nil {
+		if err := c.postStor.IndexScores(r.Context(), flag.PostId); err != nil {
+			logger.Error("error indexing scores", "post", flag.PostId, "err", err)
+		}
+		if err := c.ratingHub.Publish(r.Context(), flag.PostId, *rating); err != nil {
+			logger.Error("error publishing rating", "post", flag.PostId, "err", err)
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(flag); err != nil {
+		logger.Error("error encoding flag", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/notify"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	streamHeartbeat = 30 * time.Second
+	streamReplay    = 100
+)
+
+type NotificationController struct {
+	notificationStor *storages.NotificationStorage
+	sessionStor      *storages.SessionStorage
+	broker           *notify.Broker
+}
+
+func NewNotificationController(notificationStor *storages.NotificationStorage,
+	sessionStor *storages.SessionStorage, broker *notify.Broker) *NotificationController {
+	return &NotificationController{
+		notificationStor: notificationStor,
+		sessionStor:      sessionStor,
+		broker:           broker,
+	}
+}
+
+func (c *NotificationController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath, c.GetNotifications).Methods("GET")
+	router.HandleFunc(basePath+"/stream", c.Stream).Methods("GET")
+	router.HandleFunc(basePath+"/read", c.MarkRead).Methods("PUT")
+}
+
+type MarkReadDTO struct {
+	SessionToken string `json:"sessionToken"`
+	// Ids are the notifications to mark read, all of the user's when empty.
+	Ids []int64 `json:"ids"`
+}
+
+// GetNotifications returns a page of the caller's notifications, only unread ones with ?unread=true.
+func (c *NotificationController) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+	size, page, err := getPageParams(w, r)
+	if err != nil {
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, total, unread, err := c.notificationStor.GetForUser(r.Context(), userVk.Info.Id, unreadOnly, size, page)
+	if err != nil {
+		logger.Error("error getting notifications", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":         total,
+		"unread":        unread,
+		"notifications": notifications,
+	}); err != nil {
+		logger.Error("error encoding notifications", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *NotificationController) MarkRead(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	var markDto MarkReadDTO
+	if !decodeBody(w, r, &markDto) {
+		return
+	}
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		markDto.SessionToken = token
+	}
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: markDto.SessionToken}, w)
+	if err != nil {
+		return
+	}
+
+	unread, err := c.notificationStor.MarkRead(r.Context(), userVk.Info.Id, markDto.Ids)
+	if err != nil {
+		logger.Error("error marking notifications read", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]int{"unread": unread}); err != nil {
+		logger.Error("error encoding unread", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+// Stream pushes the caller's new notifications as server-sent events. EventSource can't
+// set headers, so the token usually comes in the sessionToken query param. A reconnecting
+// client's Last-Event-ID replays what it missed.
+func (c *NotificationController) Stream(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "Streaming unsupported")
+		return
+	}
+
+	// Subscribe before the replay, so nothing created in between is lost.
+	notifications, unsubscribe := c.broker.Subscribe(userVk.Info.Id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// The stream outlives the server write timeout; the heartbeat detects dead clients.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Warn("error clearing write deadline", "err", err)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var lastId int64
+	if lastEventId, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		missed, err := c.notificationStor.GetSince(r.Context(), userVk.Info.Id, lastEventId, streamReplay)
+		if err != nil {
+			logger.Error("error replaying notifications", "user", userVk.Info.Id, "err", err)
+			return
+		}
+		lastId = lastEventId
+		for _, notification := range missed {
+			if !c.writeEvent(logger, w, notification.Id, notification) {
+				return
+			}
+			lastId = notification.Id
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if notification.Id <= lastId {
+				continue
+			}
+			if !c.writeEvent(logger, w, notification.Id, notification) {
+				return
+			}
+			lastId = notification.Id
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (c *NotificationController) writeEvent(logger *slog.Logger, w http.ResponseWriter, id int64, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("error encoding notification event", "err", err)
+		return false
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", id, payload); err != nil {
+		return false
+	}
+	return true
+}
@@ -1,34 +1,64 @@
 package controllers
 
 import (
+	"TaskService/i18n"
+	"TaskService/live"
+	"TaskService/logging"
+	"TaskService/metrics"
 	"TaskService/models"
 	"TaskService/models/cache"
+	"TaskService/notify"
+	"TaskService/problem"
 	"TaskService/storages"
+	"TaskService/validation"
 	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
+	"github.com/jackc/pgx/v5"
 	"net/http"
-	"strconv"
 	"strings"
 )
 
 type PostController struct {
-	logger             *log.Logger
 	postStor           *storages.PostStorage
 	sessionStor        *storages.SessionStorage
 	userPostRatingStor *storages.UserPostRatingStorage
+	bookmarkStor       *storages.BookmarkStorage
+	mediaStor          *storages.MediaStorage
+	translationStor    *storages.TranslationStorage
+	langs              *i18n.Languages
+	notifier           *notify.Notifier
+	ratingHub          *live.RatingHub
+	decorator          postDecorator
 }
 
-func NewPostController(logger *log.Logger, stor *storages.PostStorage,
+func NewPostController(stor *storages.PostStorage,
 	sessionStor *storages.SessionStorage,
-	userPostRatingStor *storages.UserPostRatingStorage) *PostController {
+	userPostRatingStor *storages.UserPostRatingStorage,
+	bookmarkStor *storages.BookmarkStorage,
+	mediaStor *storages.MediaStorage,
+	translationStor *storages.TranslationStorage,
+	langs *i18n.Languages,
+	notifier *notify.Notifier,
+	ratingHub *live.RatingHub) *PostController {
 	return &PostController{
-		logger:             logger,
 		postStor:           stor,
 		sessionStor:        sessionStor,
 		userPostRatingStor: userPostRatingStor,
+		bookmarkStor:       bookmarkStor,
+		mediaStor:          mediaStor,
+		translationStor:    translationStor,
+		langs:              langs,
+		notifier:           notifier,
+		ratingHub:          ratingHub,
+		decorator: postDecorator{
+			mediaStor:          mediaStor,
+			translationStor:    translationStor,
+			langs:              langs,
+			bookmarkStor:       bookmarkStor,
+			userPostRatingStor: userPostRatingStor,
+		},
 	}
 }
 
@@ -44,30 +74,45 @@ func (c *PostController) Register(basePath string, router *mux.Router) {
 
 	router.HandleFunc(basePath+"/{id}/inc", c.Increment).Methods("PUT")
 	router.HandleFunc(basePath+"/{id}/dec", c.Decrement).Methods("PUT")
-}
+	router.HandleFunc(basePath+"/{id}/vote", c.Vote).Methods("PUT")
 
-type TokenDTO struct {
-	SessionToken string `json:"sessionToken"`
+	router.HandleFunc(basePath+"/{id}/bookmark", c.Bookmark).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}/bookmark", c.Unbookmark).Methods("DELETE")
 }
 
 func (c *PostController) Search(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	size, page, search, err := c.getSearchParams(w, r)
 	if err != nil {
 		return
 	}
 
-	esRes, err := c.postStor.SearchES(search, size, page)
+	sort, err := c.getSort(w, r)
 	if err != nil {
-		c.logger.Println("Error in Search(), query: ", search, ", page: ", page, ", size", size, "\nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
 		return
 	}
-	c.logger.Println("Got ids: ", esRes)
 
-	posts, err := c.postStor.GetMany(esRes.Ids)
+	esRes, err := c.postStor.SearchES(r.Context(), search, size, page, sort, c.langs.Pick(w, r))
+	if err != nil {
+		logger.Error("error searching", "query", search, "page", page, "size", size, "err", err)
+		writeError(w, err)
+		return
+	}
+	logger.Debug("search hits", "ids", esRes)
+	if page == 1 && len(esRes.Ids) == 0 {
+		metrics.SearchWithoutHits()
+	}
+
+	posts, err := c.postStor.GetMany(r.Context(), esRes.Ids)
 	if err != nil {
-		c.logger.Println("Error getting many posts by ids in Search(), Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error getting many posts by ids", "err", err)
+		writeError(w, err)
+		return
+	}
+	posts = orderPostsByIds(posts, esRes.Ids)
+	if err := c.decoratePosts(w, r, posts); err != nil {
+		logger.Error("error decorating posts", "err", err)
+		writeError(w, err)
 		return
 	}
 
@@ -80,8 +125,8 @@ func (c *PostController) Search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		c.logger.Printf("Error encoding posts in Search(), posts: %v", posts)
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error encoding posts", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
@@ -92,13 +137,11 @@ func (c *PostController) Increment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userVk, err := c.tryGetSession(tokenDto, w)
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, tokenDto, w)
 	if err != nil {
 		return
 	}
 
-	c.logger.Println("Token in Increment(): ", tokenDto.SessionToken)
-
 	c.changeRating('+', userVk, w, r)
 }
 
@@ -108,253 +151,365 @@ func (c *PostController) Decrement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userVk, err := c.tryGetSession(tokenDto, w)
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, tokenDto, w)
 	if err != nil {
 		return
 	}
 
-	c.logger.Println("Token in Decrement(): ", tokenDto.SessionToken)
-
 	c.changeRating('-', userVk, w, r)
 }
 
-func (c *PostController) changeRating(oper rune, userVk *cache.UserVk, w http.ResponseWriter, r *http.Request) {
+func (c *PostController) Bookmark(w http.ResponseWriter, r *http.Request) {
+	c.setBookmark(true, w, r)
+}
+
+func (c *PostController) Unbookmark(w http.ResponseWriter, r *http.Request) {
+	c.setBookmark(false, w, r)
+}
+
+func (c *PostController) setBookmark(bookmarked bool, w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	id, err := c.getId(w, r)
 	if err != nil {
 		return
 	}
 
-	if !c.userPostRatingStor.OperAllowed(oper) {
-		c.logger.Println("Invalid oper in changeRating(), oper: ", string(oper))
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+	tokenDto, err := c.getSessionToken(w, r)
+	if err != nil {
 		return
 	}
 
-	post, err := c.postStor.GetOne(id)
-	if err != nil || post == nil {
-		c.logger.Println("Unexisted id: ", id)
-		http.Error(w, "Id does not exist, id: "+id, http.StatusBadRequest)
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, tokenDto, w)
+	if err != nil {
 		return
 	}
 
-	userPostRating := &models.UserPostRating{
-		UserId: userVk.Info.Id,
-		PostId: id,
-		Oper:   oper,
-	}
-	if err := c.userPostRatingStor.SetUserOper(userPostRating); err != nil {
-		if doubleError, isDoubleError := err.(storages.DoubleOperError); isDoubleError {
-			c.logger.Println(doubleError.Error(), doubleError.Data)
-			http.Error(w, doubleError.Error(), http.StatusNotModified)
+	if bookmarked {
+		if _, err := c.postStor.GetOne(r.Context(), id); err != nil {
+			logger.Warn("unexisted id", "id", id, "err", err)
+			writeLookupError(w, err, problem.PostNotFound)
 			return
 		}
+		err = c.bookmarkStor.Add(r.Context(), userVk.Info.Id, id)
+	} else {
+		err = c.bookmarkStor.Remove(r.Context(), userVk.Info.Id, id)
+	}
+	if err != nil {
+		logger.Error("error changing bookmark", "id", id, "bookmarked", bookmarked, "err", err)
+		writeError(w, err)
+		return
+	}
 
-		if invalidOperError, isInvalidOperError := err.(storages.InvalidOperError); isInvalidOperError {
-			c.logger.Println(invalidOperError.Error())
-			http.Error(w, invalidOperError.Error(), http.StatusBadRequest)
-			return
-		}
+	if err := json.NewEncoder(w).Encode(struct {
+		IsBookmarked bool `json:"isBookmarked"`
+	}{IsBookmarked: bookmarked}); err != nil {
+		logger.Error("error encoding bookmark", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+type VoteDTO struct {
+	SessionToken string `json:"sessionToken"`
+	Value        *int   `json:"value" validate:"required,min=-1,max=1"`
+}
+
+func (c *PostController) Vote(w http.ResponseWriter, r *http.Request) {
+	id, err := c.getId(w, r)
+	if err != nil {
+		return
+	}
+
+	var voteDto VoteDTO
+	if !decodeBody(w, r, &voteDto) {
+		return
+	}
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		voteDto.SessionToken = token
+	}
 
-		c.logger.Printf("Error changing rating in changeRating(), Oper: %v, Error: %v", oper, err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: voteDto.SessionToken}, w)
+	if err != nil {
 		return
 	}
 
-	delta := c.userPostRatingStor.OperToDelta(oper)
+	value := *voteDto.Value
+	c.setVote(id, userVk, w, r, func(int) (int, error) {
+		return value, nil
+	})
+}
 
-	post.Rating += delta
-	newRating, err := c.postStor.ChangeRatingRelatively(post.Id, delta)
+// changeRating keeps the relative /inc and /dec semantics on top of setVote.
+func (c *PostController) changeRating(oper rune, userVk *cache.UserVk, w http.ResponseWriter, r *http.Request) {
+	id, err := c.getId(w, r)
 	if err != nil {
-		c.logger.Println("Error updating post, \nPost: ", post, "\n Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
 		return
 	}
 
+	c.setVote(id, userVk, w, r, func(current int) (int, error) {
+		return c.userPostRatingStor.NextVote(current, oper)
+	})
+}
+
+func (c *PostController) setVote(id string, userVk *cache.UserVk, w http.ResponseWriter, r *http.Request,
+	next func(current int) (int, error)) {
+	logger := logging.FromContext(r.Context())
+	result, err := c.userPostRatingStor.ApplyVote(r.Context(), userVk, id, next)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Warn("unexisted id", "id", id)
+			writeProblem(w, http.StatusNotFound, problem.PostNotFound, "")
+			return
+		}
+
+		var doubleError *storages.DoubleOperError
+		if errors.As(err, &doubleError) {
+			logger.Info(doubleError.Error(), "vote", doubleError.Vote)
+			writeError(w, err)
+			return
+		}
+
+		var invalidOperError *storages.InvalidOperError
+		if errors.As(err, &invalidOperError) {
+			logger.Warn(invalidOperError.Error())
+			writeError(w, err)
+			return
+		}
+
+		logger.Error("error applying vote", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	// Repeating a vote changes nothing, so it is neither counted nor reindexed.
+	if result.Changed {
+		metrics.VoteCast(result.Vote)
+	}
+	if result.RatingChanged {
+		if err := c.postStor.IndexScores(r.Context(), id); err != nil {
+			logger.Error("error indexing scores", "id", id, "err", err)
+		}
+		if err := c.ratingHub.Publish(r.Context(), id, result.Rating); err != nil {
+			logger.Error("error publishing rating", "id", id, "err", err)
+		}
+	}
+
 	if err := json.NewEncoder(w).Encode(struct {
 		Rating int `json:"rating"`
-	}{Rating: newRating}); err != nil {
-		c.logger.Println("Error encoding rating, \nrating: ", newRating, "\n Error: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		Vote   int `json:"vote"`
+	}{Rating: result.Rating, Vote: result.Vote}); err != nil {
+		logger.Error("error encoding rating", "rating", result.Rating, "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
 
 func (c *PostController) AddPost(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	var post models.PostAddDTO
-	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
-		c.logger.Println("Error decoding AddPost()\n Post: ", post, "\nError: ", err.Error())
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+	if !decodeBody(w, r, &post) {
 		return
 	}
-	c.logger.Println("Decoded post in AddPost(),\n Post: ", post)
+	logger.Debug("decoded post", "post", post)
 
-	if post.Title == "" {
-		c.logger.Println("Error post create without title,\n Post: ", post)
-		http.Error(w, "Creating post without title", http.StatusBadRequest)
+	if !c.mediaExists(post.MediaId, w, r) {
 		return
 	}
 
-	id, err := c.postStor.Create(post.Title, post.Content, post.Img)
+	id, err := c.postStor.Create(r.Context(), &post)
 
 	if err != nil {
-		c.logger.Println("Error creating post AddPost()\n Post: ", post, "\nError: ", err.Error())
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		logger.Error("error creating post", "post", post, "err", err)
+		writeError(w, err)
 		return
 	}
+	metrics.PostCreated()
 	resp := struct {
 		Id string `json:"id"`
 	}{Id: id}
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		c.logger.Println("Error encoding id AddPost()\n Post: ", post, "\nId: ", id, "\nError: ", err.Error())
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		logger.Error("error encoding id", "post", post, "id", id, "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
 
 func (c *PostController) GetPost(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	id, err := c.getId(w, r)
 	if err != nil {
 		return
 	}
-	post, err := c.postStor.GetOne(id)
+	post, err := c.postStor.GetOne(r.Context(), id)
 	if err != nil {
-		c.logger.Println("Error getting post in GetOne() \nError: ", err.Error())
-		http.Error(w, "not found", http.StatusNotFound)
+		logger.Error("error getting post", "err", err)
+		writeLookupError(w, err, problem.PostNotFound)
+		return
+	}
+	posts := []models.Post{*post}
+	if err := c.decoratePosts(w, r, posts); err != nil {
+		logger.Error("error decorating post", "err", err)
+		writeError(w, err)
 		return
 	}
-	if err := json.NewEncoder(w).Encode(post); err != nil {
-		c.logger.Println("Error encoding post in GetOne() \nError: ", err.Error())
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+	w.Header().Set("Content-Language", posts[0].Lang)
+	if err := json.NewEncoder(w).Encode(posts[0]); err != nil {
+		logger.Error("error encoding post", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
 
-func (c *PostController) GetPosts(w http.ResponseWriter, _ *http.Request) {
+func (c *PostController) GetPosts(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	sort, err := c.getSort(w, r)
+	if err != nil {
+		return
+	}
+
 	limit := 100
-	tasks, err := c.postStor.GetAll(limit)
+	tasks, err := c.postStor.GetAll(r.Context(), limit, sort)
 
 	if err != nil {
-		c.logger.Println("Error getting posts in GetPosts() \nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error getting posts", "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := c.decoratePosts(w, r, tasks); err != nil {
+		logger.Error("error decorating posts", "err", err)
+		writeError(w, err)
 		return
 	}
 	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		c.logger.Println("Error encoding posts in GetPosts() \nError: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+		logger.Error("error encoding posts", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
 		return
 	}
 }
 
 func (c *PostController) DeletePost(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	id, err := c.getId(w, r)
 	if err != nil {
 		return
 	}
 
-	if err := c.postStor.Delete(id); err != nil {
-		c.logger.Println("Error deleting post in DeletePost() \nError: ", err.Error())
-		http.Error(w, "id not found", http.StatusBadRequest)
+	post, err := c.postStor.GetOne(r.Context(), id)
+	if err != nil {
+		logger.Warn("error getting post", "id", id, "err", err)
+		writeLookupError(w, err, problem.PostNotFound)
 		return
 	}
+	// Bookmarks go with the post, so their owners are looked up first and notified
+	// once the post is gone.
+	bookmarkers, err := c.bookmarkStor.GetUserIds(r.Context(), id)
+	if err != nil {
+		logger.Error("error getting bookmarkers", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := c.postStor.Delete(r.Context(), id); err != nil {
+		logger.Error("error deleting post", "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := c.notifier.PostDeleted(r.Context(), post, bookmarkers, c.actorId(r)); err != nil {
+		logger.Error("error notifying bookmarkers", "post", id, "err", err)
+	}
 }
 
 func (c *PostController) UpdatePost(w http.ResponseWriter, r *http.Request) {
-	var newTask *models.Post
-	if err := json.NewDecoder(r.Body).Decode(&newTask); err != nil {
-		c.logger.Println("Error decoding task: ", newTask, "err: ", err.Error())
-		http.Error(w, "Invalid task", http.StatusBadRequest)
+	logger := logging.FromContext(r.Context())
+	var update models.PostUpdateDTO
+	if !decodeBody(w, r, &update) {
 		return
 	}
-	if err := c.postStor.Update(newTask); err != nil {
-		c.logger.Println("Error updating task: ", newTask, "err: ", err.Error())
-		http.Error(w, "Internal server", http.StatusInternalServerError)
+	if update.MediaId != nil && !c.mediaExists(*update.MediaId, w, r) {
 		return
 	}
+	post, err := c.postStor.Update(r.Context(), &update)
+	if err != nil {
+		logger.Error("error updating post", "id", update.Id, "err", err)
+		writeLookupError(w, err, problem.PostNotFound)
+		return
+	}
+	if err := c.notifier.PostUpdated(r.Context(), post, c.actorId(r)); err != nil {
+		logger.Error("error notifying bookmarkers", "post", post.Id, "err", err)
+	}
+}
+
+// actorId returns the id of the user making the request, or 0 when it is not known,
+// so bookmarkers are told about a change except the one who made it.
+func (c *PostController) actorId(r *http.Request) int64 {
+	if userVk := getOptionalSession(c.sessionStor, r); userVk != nil {
+		return userVk.Info.Id
+	}
+	return 0
 }
 
 func (c *PostController) getId(w http.ResponseWriter, r *http.Request) (string, error) {
+	logger := logging.FromContext(r.Context())
 	id := mux.Vars(r)["id"]
 	if _, err := uuid.Parse(id); err != nil {
-		c.logger.Println("Error parsing id in getId(), \nId: ", id, "\nError: ", err.Error())
-		http.Error(w, "id incorrect", http.StatusBadRequest)
+		logger.Warn("error parsing id", "id", id, "err", err)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "id incorrect")
 		return id, err
 	}
 	return id, nil
 }
 
 func (c *PostController) getSessionToken(w http.ResponseWriter, r *http.Request) (*TokenDTO, error) {
-	var tokenDto *TokenDTO
-	if err := json.NewDecoder(r.Body).Decode(&tokenDto); err != nil {
-		c.logger.Println("Error decoding tokenDto in Increment(), Error: ", err.Error())
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		return &TokenDTO{SessionToken: token}, nil
+	}
+
+	tokenDto := &TokenDTO{}
+	if !decodeBody(w, r, tokenDto) {
 		return nil, errors.New("invalid body")
 	}
 	return tokenDto, nil
 }
 
-func (c *PostController) tryGetSession(tokenDto *TokenDTO, w http.ResponseWriter) (*cache.UserVk, error) {
-	if tokenDto.SessionToken == "" {
-		c.logger.Println("Got no token in Increment()")
-		http.Error(w, "Got no sessonToken", http.StatusUnauthorized)
-		return nil, errors.New("no token")
+func (c *PostController) getSearchParams(w http.ResponseWriter, r *http.Request) (size int, page int, search string, err error) {
+	size, page, err = getPageParams(w, r)
+	if err != nil {
+		return 0, 0, "", err
 	}
 
-	userVk, err := c.sessionStor.GetSession(tokenDto.SessionToken)
-	if err != nil || !userVk.Valid() {
-		c.logger.Println("Expired token in Increment(), token: ", tokenDto.SessionToken)
-		if err != nil {
-			c.logger.Println("Error: ", err.Error())
-		}
-		http.Error(w, "Token expired", http.StatusUnauthorized)
-		return nil, errors.New("token expired")
+	search = ""
+	if searchQuery := r.URL.Query()["search"]; len(searchQuery) > 0 {
+		search = strings.TrimSpace(searchQuery[0])
 	}
 
-	return userVk, nil
+	return size, page, search, nil
 }
 
-func (c *PostController) getSearchParams(w http.ResponseWriter, r *http.Request) (size int, page int, search string, err error) {
-	query := r.URL.Query()
-	pageQuery, ok := query["page"]
-	if !ok || len(pageQuery) < 1 {
-		c.logger.Println("Has no page in query for Search()")
-		http.Error(w, "Has no page in query for Search()", http.StatusBadRequest)
-		return 0, 0, "", errors.New("no page")
-	}
-	sizeQuery, ok := query["size"]
-	if !ok || len(sizeQuery) < 1 {
-		c.logger.Println("Has no size in query for Search()")
-		http.Error(w, "Has no size in query for Search()", http.StatusBadRequest)
-		return 0, 0, "", errors.New("no size")
-	}
-	searchQuery := query["search"]
-	page, err = strconv.Atoi(pageQuery[0])
-	if err != nil {
-		c.logger.Println("Page in Search() is not integer")
-		http.Error(w, "Page is not integer", http.StatusBadRequest)
-		return 0, 0, "", errors.New("page is not int")
-	}
-	if page < 1 {
-		c.logger.Println("Page in Search() is less than 1")
-		http.Error(w, "Page is less than 1", http.StatusBadRequest)
-		return 0, 0, "", errors.New("page is less than 1")
+func (c *PostController) getSort(w http.ResponseWriter, r *http.Request) (storages.PostSort, error) {
+	logger := logging.FromContext(r.Context())
+	sort := storages.PostSort(r.URL.Query().Get("sort"))
+	if !sort.Valid() {
+		logger.Warn("invalid sort", "sort", sort)
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Sort must be one of best, hot, top")
+		return storages.SortNone, errors.New("invalid sort")
 	}
+	return sort, nil
+}
 
-	size, err = strconv.Atoi(sizeQuery[0])
-	if err != nil {
-		c.logger.Println("Size in Search() is not integer")
-		http.Error(w, "Size is not integer", http.StatusBadRequest)
-		return 0, 0, "", errors.New("size is not int")
+// mediaExists checks that a referenced media id was uploaded. An empty id references nothing.
+func (c *PostController) mediaExists(mediaId string, w http.ResponseWriter, r *http.Request) bool {
+	logger := logging.FromContext(r.Context())
+	if mediaId == "" {
+		return true
 	}
-	if size < 1 {
-		c.logger.Println("Size in Search() is less than 1")
-		http.Error(w, "Size is less than 1", http.StatusBadRequest)
-		return 0, 0, "", errors.New("size is less than 1")
-	}
-
-	search = ""
-	if len(searchQuery) > 0 {
-		search = strings.TrimSpace(searchQuery[0])
+	if _, err := c.mediaStor.GetOne(r.Context(), mediaId); err != nil {
+		logger.Warn("unknown media", "mediaId", mediaId, "err", err)
+		writeViolations(w, validation.Errors{"mediaId": "does not exist"})
+		return false
 	}
+	return true
+}
 
-	return size, page, search, nil
+// decoratePosts fills the fields of posts that aren't stored with them, the per-user
+// ones when the request is authenticated.
+func (c *PostController) decoratePosts(w http.ResponseWriter, r *http.Request, posts []models.Post) error {
+	return c.decorator.decorate(w, r, getOptionalSession(c.sessionStor, r), posts)
 }
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+type ReminderController struct {
+	reminderStor *storages.ReminderStorage
+	sessionStor  *storages.SessionStorage
+}
+
+func NewReminderController(reminderStor *storages.ReminderStorage,
+	sessionStor *storages.SessionStorage) *ReminderController {
+	return &ReminderController{
+		reminderStor: reminderStor,
+		sessionStor:  sessionStor,
+	}
+}
+
+func (c *ReminderController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath, c.GetReminders).Methods("GET")
+	router.HandleFunc(basePath+"/preferences", c.GetPreference).Methods("GET")
+	router.HandleFunc(basePath+"/preferences", c.SetPreference).Methods("PUT")
+	router.HandleFunc(basePath+"/preferences", c.DeletePreference).Methods("DELETE")
+}
+
+type ReminderPreferenceDTO struct {
+	SessionToken string `json:"sessionToken"`
+	DaysBefore   int    `json:"daysBefore" validate:"min=1,max=60"`
+	StartedOnly  bool   `json:"startedOnly"`
+}
+
+// GetReminders returns a page of the caller's queued and sent reminders.
+func (c *ReminderController) GetReminders(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+	size, page, err := getPageParams(w, r)
+	if err != nil {
+		return
+	}
+
+	reminders, total, err := c.reminderStor.GetForUser(r.Context(), userVk.Info.Id, size, page)
+	if err != nil {
+		logger.Error("error getting reminders", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":     total,
+		"reminders": reminders,
+	}); err != nil {
+		logger.Error("error encoding reminders", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *ReminderController) GetPreference(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+
+	preference, err := c.reminderStor.GetPreference(r.Context(), userVk.Info.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.ReminderPrefNotFound, "Reminders are off")
+		return
+	}
+	if err != nil {
+		logger.Error("error getting preference", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(preference); err != nil {
+		logger.Error("error encoding preference", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+// SetPreference opts the caller in to reminders daysBefore days before the deadlines of
+// the items they have not done, in every checklist or, with startedOnly, in those they
+// have started.
+func (c *ReminderController) SetPreference(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	var preferenceDto ReminderPreferenceDTO
+	if !decodeBody(w, r, &preferenceDto) {
+		return
+	}
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		preferenceDto.SessionToken = token
+	}
+
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: preferenceDto.SessionToken}, w)
+	if err != nil {
+		return
+	}
+
+	preference, err := c.reminderStor.SetPreference(r.Context(), userVk.Info.Id, preferenceDto.DaysBefore,
+		preferenceDto.StartedOnly)
+	if err != nil {
+		logger.Error("error saving preference", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(preference); err != nil {
+		logger.Error("error encoding preference", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+// DeletePreference opts the caller out of reminders and cancels the pending ones.
+func (c *ReminderController) DeletePreference(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userVk, err := tryGetSession(r.Context(), c.sessionStor, &TokenDTO{SessionToken: sessionTokenFromRequest(r)}, w)
+	if err != nil {
+		return
+	}
+
+	if _, err := c.reminderStor.DeletePreference(r.Context(), userVk.Info.Id); err != nil {
+		logger.Error("error deleting preference", "user", userVk.Info.Id, "err", err)
+		writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"TaskService/i18n"
+	"TaskService/logging"
+	"TaskService/models"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type TranslationController struct {
+	postStor        *storages.PostStorage
+	translationStor *storages.TranslationStorage
+	sessionStor     *storages.SessionStorage
+	langs           *i18n.Languages
+	editors         map[int64]bool
+}
+
+func NewTranslationController(postStor *storages.PostStorage,
+	translationStor *storages.TranslationStorage, sessionStor *storages.SessionStorage,
+	langs *i18n.Languages, editors map[int64]bool) *TranslationController {
+	return &TranslationController{
+		postStor:        postStor,
+		translationStor: translationStor,
+		sessionStor:     sessionStor,
+		langs:           langs,
+		editors:         editors,
+	}
+}
+
+func (c *TranslationController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath+"/{id}/translations", c.GetTranslations).Methods("GET")
+	router.HandleFunc(basePath+"/{id}/translations/{lang}", c.PutTranslation).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}/translations/{lang}", c.DeleteTranslation).Methods("DELETE")
+}
+
+func (c *TranslationController) GetTranslations(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	id, ok := c.getPostId(w, r)
+	if !ok {
+		return
+	}
+
+	translations, err := c.translationStor.GetAll(r.Context(), id)
+	if err != nil {
+		logger.Error("error getting translations", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(translations); err != nil {
+		logger.Error("error encoding translations", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *TranslationController) PutTranslation(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := c.getPostId(w, r)
+	if !ok {
+		return
+	}
+	lang, ok := c.getLang(w, r)
+	if !ok {
+		return
+	}
+
+	var translationDto models.PostTranslationDTO
+	if !decodeBody(w, r, &translationDto) {
+		return
+	}
+
+	if _, err := c.postStor.GetOne(r.Context(), id); err != nil {
+		writeLookupError(w, err, problem.PostNotFound)
+		return
+	}
+
+	translation, err := c.translationStor.Upsert(r.Context(), id, lang, &translationDto)
+	if err != nil {
+		logger.Error("error saving translation", "id", id, "lang", lang, "err", err)
+		writeError(w, err)
+		return
+	}
+	if err := c.postStor.IndexTranslation(r.Context(), translation); err != nil {
+		logger.Error("error indexing translation", "id", id, "lang", lang, "err", err)
+	}
+
+	if err := json.NewEncoder(w).Encode(translation); err != nil {
+		logger.Error("error encoding translation", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+		return
+	}
+}
+
+func (c *TranslationController) DeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.editors, w, r); err != nil {
+		return
+	}
+	id, ok := c.getPostId(w, r)
+	if !ok {
+		return
+	}
+	lang, ok := c.getLang(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := c.translationStor.Delete(r.Context(), id, lang)
+	if err != nil {
+		logger.Error("error deleting translation", "id", id, "lang", lang, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !deleted {
+		writeProblem(w, http.StatusNotFound, problem.TranslationNotFound, "")
+		return
+	}
+	if err := c.postStor.RemoveTranslation(r.Context(), id, lang); err != nil {
+		logger.Error("error unindexing translation", "id", id, "lang", lang, "err", err)
+	}
+}
+
+func (c *TranslationController) getPostId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "id incorrect")
+		return "", false
+	}
+	return id, true
+}
+
+// getLang accepts supported languages other than the default, which the post itself is written in.
+func (c *TranslationController) getLang(w http.ResponseWriter, r *http.Request) (string, bool) {
+	lang := mux.Vars(r)["lang"]
+	if !c.langs.Supported(lang) || lang == c.langs.Default {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "Unsupported translation language: "+lang)
+		return "", false
+	}
+	return lang, true
+}
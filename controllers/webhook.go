@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"TaskService/logging"
+	"TaskService/models"
+	"TaskService/problem"
+	"TaskService/storages"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+)
+
+type WebhookController struct {
+	webhookStor *storages.WebhookStorage
+	sessionStor *storages.SessionStorage
+	admins      map[int64]bool
+}
+
+func NewWebhookController(webhookStor *storages.WebhookStorage,
+	sessionStor *storages.SessionStorage, admins map[int64]bool) *WebhookController {
+	return &WebhookController{
+		webhookStor: webhookStor,
+		sessionStor: sessionStor,
+		admins:      admins,
+	}
+}
+
+func (c *WebhookController) Register(basePath string, router *mux.Router) {
+	router.HandleFunc(basePath, c.GetWebhooks).Methods("GET")
+	router.HandleFunc(basePath, c.AddWebhook).Methods("POST")
+	router.HandleFunc(basePath+"/{id}", c.GetWebhook).Methods("GET")
+	router.HandleFunc(basePath+"/{id}", c.UpdateWebhook).Methods("PUT")
+	router.HandleFunc(basePath+"/{id}", c.DeleteWebhook).Methods("DELETE")
+	router.HandleFunc(basePath+"/{id}/deliveries", c.GetDeliveries).Methods("GET")
+	router.HandleFunc(basePath+"/{id}/deliveries/{deliveryId}/redeliver", c.Redeliver).Methods("POST")
+}
+
+func (c *WebhookController) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+
+	webhooks, err := c.webhookStor.GetAll(r.Context())
+	if err != nil {
+		logger.Error("error getting webhooks", "err", err)
+		writeError(w, err)
+		return
+	}
+	c.encode(w, r, webhooks)
+}
+
+func (c *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	webhook, err := c.webhookStor.GetOne(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.WebhookNotFound, "")
+		return
+	}
+	if err != nil {
+		logger.Error("error getting webhook", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	c.encode(w, r, webhook)
+}
+
+// AddWebhook subscribes a URL to post events. The response is the only one showing the secret.
+func (c *WebhookController) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	admin, err := tryGetPrivileged(c.sessionStor, c.admins, w, r)
+	if err != nil {
+		return
+	}
+	webhookDto, ok := c.decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := c.webhookStor.Create(r.Context(), webhookDto)
+	if err != nil {
+		logger.Error("error creating webhook", "err", err)
+		writeError(w, err)
+		return
+	}
+	logger.Info("webhook created", "id", webhook.Id, "url", webhook.Url, "admin", admin.Info.Id)
+
+	w.WriteHeader(http.StatusCreated)
+	c.encode(w, r, webhook)
+}
+
+func (c *WebhookController) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	webhookDto, ok := c.decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := c.webhookStor.Update(r.Context(), id, webhookDto)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.WebhookNotFound, "")
+		return
+	}
+	if err != nil {
+		logger.Error("error updating webhook", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	c.encode(w, r, webhook)
+}
+
+func (c *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	deleted, err := c.webhookStor.Delete(r.Context(), id)
+	if err != nil {
+		logger.Error("error deleting webhook", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	if !deleted {
+		writeProblem(w, http.StatusNotFound, problem.WebhookNotFound, "")
+		return
+	}
+}
+
+// GetDeliveries returns a page of the webhook's delivery log with the response codes.
+func (c *WebhookController) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	size, page, err := getPageParams(w, r)
+	if err != nil {
+		return
+	}
+
+	deliveries, total, err := c.webhookStor.GetDeliveries(r.Context(), id, size, page)
+	if err != nil {
+		logger.Error("error getting deliveries", "id", id, "err", err)
+		writeError(w, err)
+		return
+	}
+	c.encode(w, r, map[string]interface{}{
+		"total":      total,
+		"deliveries": deliveries,
+	})
+}
+
+// Redeliver queues the payload of a past delivery again, e.g. after the receiver was fixed.
+func (c *WebhookController) Redeliver(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if _, err := tryGetPrivileged(c.sessionStor, c.admins, w, r); err != nil {
+		return
+	}
+	id, ok := getUuidVar(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryId, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, problem.ValidationFailed, "deliveryId incorrect")
+		return
+	}
+
+	delivery, err := c.webhookStor.Redeliver(r.Context(), id, deliveryId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(w, http.StatusNotFound, problem.DeliveryNotFound, "")
+		return
+	}
+	if err != nil {
+		logger.Error("error redelivering", "delivery", deliveryId, "err", err)
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	c.encode(w, r, delivery)
+}
+
+func (c *WebhookController) decodeWebhook(w http.ResponseWriter, r *http.Request) (*models.WebhookDTO, bool) {
+	var webhookDto models.WebhookDTO
+	if !decodeBody(w, r, &webhookDto) {
+		return nil, false
+	}
+	return &webhookDto, true
+}
+
+func (c *WebhookController) encode(w http.ResponseWriter, r *http.Request, value interface{}) {
+	logger := logging.FromContext(r.Context())
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("error encoding webhook response", "err", err)
+		writeProblem(w, http.StatusInternalServerError, problem.Internal, "")
+	}
+}
@@ -1,33 +1,45 @@
 package db
 
 import (
+	"TaskService/logging"
+	"TaskService/metrics"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
-	"log"
+	"log/slog"
+	"net/http"
+	"time"
 )
 
 type EsDb struct {
-	client *elasticsearch.Client
-	logger *log.Logger
+	client    *elasticsearch.Client
+	transport *http.Transport
+	timeout   time.Duration
+	logger    *slog.Logger
 }
 
-func NewEsDb(logger *log.Logger) *EsDb {
-	client, err := elasticsearch.NewDefaultClient()
+// NewEsDb connects to the cluster at addresses. Every request is cancelled after timeout.
+func NewEsDb(logger *slog.Logger, addresses []string, timeout time.Duration) *EsDb {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: addresses,
+		Transport: tracingTransport{next: transport},
+	})
 	if err != nil {
 		panic(err)
 	}
 	res, err := client.Info()
 	if err != nil {
-		logger.Fatal("Can't connect to es")
+		logging.Fatal(logger, "can't connect to es", "err", err)
 	}
 
 	defer res.Body.Close()
-	logger.Println("Connected to es")
-	return &EsDb{client: client, logger: logger}
+	logger.Info("connected to es")
+	return &EsDb{client: client, transport: transport, timeout: timeout, logger: logger}
 }
 
 type ESSearchResponse struct {
@@ -50,28 +62,52 @@ type ESSearchResponseHitsInner struct {
 	Source json.RawMessage `json:"_source"`
 }
 
-func (e *EsDb) CreateIndex(index string) error {
-	if exists := e.IndexExist(index); exists {
+func (e *EsDb) CreateIndex(ctx context.Context, index string) error {
+	if exists := e.IndexExist(ctx, index); exists {
 		return nil
 	}
 
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
 	res, err := e.client.Indices.Create(
 		index,
-		e.client.Indices.Create.WithContext(context.Background()),
+		e.client.Indices.Create.WithContext(ctx),
 	)
+	metrics.ObserveDatastore("es", "create_index", start, responseError(res, err))
 	defer res.Body.Close()
 
 	if res.IsError() {
-		e.logger.Fatalf("Error error creating index: %s", res.String())
+		logging.Fatal(e.logger, "error creating index", "index", index, "response", res.String())
 	}
 
 	return err
 }
 
-func (e *EsDb) IndexExist(index string) bool {
-	res, err := e.client.Indices.Exists([]string{index})
+// PutMapping adds field mappings to an existing index. Fields that are already
+// mapped with the same type are left as is.
+func (e *EsDb) PutMapping(ctx context.Context, index string, properties map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"properties": properties})
 	if err != nil {
-		e.logger.Fatalf("Error checking if index exists: %s", err)
+		return errors.New("error marshaling mapping")
+	}
+
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{index},
+		Body:  bytes.NewReader(body),
+	}
+
+	return e.withoutResponse(ctx, "put_mapping", req)
+}
+
+func (e *EsDb) IndexExist(ctx context.Context, index string) bool {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	res, err := e.client.Indices.Exists([]string{index}, e.client.Indices.Exists.WithContext(ctx))
+	metrics.ObserveDatastore("es", "index_exists", start, err)
+	if err != nil {
+		logging.Fatal(e.logger, "error checking if index exists", "index", index, "err", err)
 	}
 	defer res.Body.Close()
 
@@ -80,14 +116,41 @@ func (e *EsDb) IndexExist(index string) bool {
 	}
 
 	if res.StatusCode == 200 {
-		e.logger.Printf("Index %s already exists", index)
+		e.logger.Info("index already exists", "index", index)
 		return true
 	}
 
 	return res.StatusCode == 200
 }
 
-func (e *EsDb) Search(index, query string, fields []string, size, page int) (*ESSearchResponse, error) {
+// Close drops the idle connections; the client keeps no other resources.
+func (e *EsDb) Close() {
+	e.transport.CloseIdleConnections()
+}
+
+// Ping checks that the cluster responds.
+func (e *EsDb) Ping(ctx context.Context) error {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	res, err := e.client.Ping(e.client.Ping.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.Status())
+	}
+	return nil
+}
+
+func (e *EsDb) Search(ctx context.Context, index, query string, fields []string, size, page int) (*ESSearchResponse, error) {
+	return e.SearchScored(ctx, index, query, fields, size, page, nil, "multiply")
+}
+
+// SearchScored is Search with the text relevance combined with function_score functions
+// by boostMode, e.g. "multiply" to boost relevance or "replace" to rank by them alone.
+func (e *EsDb) SearchScored(ctx context.Context, index, query string, fields []string, size, page int,
+	functions []map[string]interface{}, boostMode string) (*ESSearchResponse, error) {
 	from := size * (page - 1)
 	if page > 1 {
 		from += 1
@@ -97,15 +160,32 @@ func (e *EsDb) Search(index, query string, fields []string, size, page int) (*ES
 		"size": size,
 		"from": from,
 	}
-	e.logger.Println("Request body to es: ", body)
+	var textQuery map[string]interface{}
 	if query != "" {
-		body["query"] = map[string]interface{}{
+		textQuery = map[string]interface{}{
 			"multi_match": map[string]interface{}{
 				"query":  query,
 				"fields": fields,
 			},
 		}
 	}
+	if len(functions) > 0 {
+		if textQuery == nil {
+			textQuery = map[string]interface{}{"match_all": map[string]interface{}{}}
+		}
+		textQuery = map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query":      textQuery,
+				"functions":  functions,
+				"score_mode": "multiply",
+				"boost_mode": boostMode,
+			},
+		}
+	}
+	if textQuery != nil {
+		body["query"] = textQuery
+	}
+	logging.FromContext(ctx).Debug("es search request", "index", index, "body", body)
 
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
@@ -116,13 +196,18 @@ func (e *EsDb) Search(index, query string, fields []string, size, page int) (*ES
 		Index: []string{index},
 		Body:  bytes.NewReader(bodyBytes),
 	}
-	res, err := req.Do(context.Background(), e.client)
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	res, err := req.Do(ctx, e.client)
+	metrics.ObserveDatastore("es", "search", start, responseError(res, err))
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
+		logging.FromContext(ctx).Warn("es search failed", "index", index, "status", res.StatusCode)
 		return nil, errors.New("response error")
 	}
 
@@ -134,7 +219,7 @@ func (e *EsDb) Search(index, query string, fields []string, size, page int) (*ES
 	return response, nil
 }
 
-func (e *EsDb) Index(index string, id string, doc any) error {
+func (e *EsDb) Index(ctx context.Context, index string, id string, doc any) error {
 	body, err := json.Marshal(doc)
 	if err != nil {
 		return errors.New("error marshaling doc")
@@ -147,11 +232,12 @@ func (e *EsDb) Index(index string, id string, doc any) error {
 		Refresh:    "true",
 	}
 
-	return e.withoutResponse(req)
+	return e.withoutResponse(ctx, "index", req)
 }
 
-func (e *EsDb) Update(index, id string, doc any) error {
-	body, err := json.Marshal(doc)
+// Update merges doc into the stored document.
+func (e *EsDb) Update(ctx context.Context, index, id string, doc any) error {
+	body, err := json.Marshal(map[string]any{"doc": doc})
 	if err != nil {
 		return errors.New("error marshaling doc")
 	}
@@ -163,23 +249,27 @@ func (e *EsDb) Update(index, id string, doc any) error {
 		Refresh:    "true",
 	}
 
-	return e.withoutResponse(req)
+	return e.withoutResponse(ctx, "update", req)
 }
 
-func (e *EsDb) Delete(index, id string) error {
+func (e *EsDb) Delete(ctx context.Context, index, id string) error {
 	req := esapi.DeleteRequest{
 		Index:      index,
 		DocumentID: id,
 		Refresh:    "true",
 	}
 
-	return e.withoutResponse(req)
+	return e.withoutResponse(ctx, "delete", req)
 }
 
-func (e *EsDb) withoutResponse(req esapi.Request) error {
-	res, err := req.Do(context.Background(), e.client)
+func (e *EsDb) withoutResponse(ctx context.Context, operation string, req esapi.Request) error {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	res, err := req.Do(ctx, e.client)
+	metrics.ObserveDatastore("es", operation, start, responseError(res, err))
 	if err != nil {
-		return errors.New("error in request")
+		return fmt.Errorf("error in request: %w", err)
 	}
 	defer res.Body.Close()
 
@@ -189,3 +279,22 @@ func (e *EsDb) withoutResponse(req esapi.Request) error {
 
 	return nil
 }
+
+// withTimeout bounds a single request by the configured timeout.
+func (e *EsDb) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+// responseError reports error responses as failed calls too, for metrics.
+func responseError(res *esapi.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return errors.New(res.Status())
+	}
+	return nil
+}
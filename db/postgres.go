@@ -4,20 +4,21 @@ import (
 	"context"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	pgxpool "github.com/jackc/pgx/v5/pgxpool"
-	"log"
-	"os"
+	"log/slog"
+	"net/url"
+	"strconv"
 	"time"
 )
 
 type PostgresDb struct {
 	Conn   *pgxpool.Pool
-	logger *log.Logger
+	logger *slog.Logger
 }
 
-func Init(logger *log.Logger) *PostgresDb {
-
-	url := os.Getenv("DATABASE_URL")
-	logger.Println("url", url)
+// Init connects to the service database on the server at url, creating it on the first
+// run. Statements running longer than timeout are cancelled by the server.
+func Init(logger *slog.Logger, url string, timeout time.Duration) *PostgresDb {
+	logger.Info("connecting to postgres", "url", redactUrl(url))
 	baseConn, err := pgxpool.New(context.Background(), url)
 	countRetry := 5
 	for err != nil && countRetry > 0 {
@@ -28,15 +29,15 @@ func Init(logger *log.Logger) *PostgresDb {
 	if err != nil {
 		panic(err)
 	}
-	logger.Println("Connected to postgres")
+	logger.Info("connected to postgres")
 	if !baseExists(baseConn) {
 		createBase(baseConn)
 	}
-	conn, err := pgxpool.New(context.Background(), url+"/summerPractice")
+	conn, err := newPool(url+"/summerPractice", timeout)
 	countRetry = 5
 	for err != nil && countRetry > 0 {
 		time.Sleep(time.Second * 1)
-		baseConn, err = pgxpool.New(context.Background(), url+"/summerPractice")
+		conn, err = newPool(url+"/summerPractice", timeout)
 		countRetry--
 	}
 	if err != nil {
@@ -46,6 +47,19 @@ func Init(logger *log.Logger) *PostgresDb {
 	return db
 }
 
+// newPool connects with every query traced and limited to timeout.
+func newPool(url string, timeout time.Duration) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+	if timeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+	}
+	return pgxpool.NewWithConfig(context.Background(), config)
+}
+
 func (d *PostgresDb) Close() {
 	d.Conn.Close()
 }
@@ -70,3 +84,16 @@ func createBase(conn *pgxpool.Pool) {
 		panic(err)
 	}
 }
+
+// redactUrl hides the password of a connection URL.
+func redactUrl(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return parsed.Redacted()
+}
+
+func (d *PostgresDb) Ping(ctx context.Context) error {
+	return d.Conn.Ping(ctx)
+}
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"TaskService/metrics"
 	"context"
 	"errors"
 	"github.com/go-redis/redis/v8"
-	"os"
+	"log/slog"
 	"time"
 )
 
@@ -13,33 +14,169 @@ var (
 )
 
 type RedisDb struct {
-	client *redis.Client
+	client  *redis.Client
+	timeout time.Duration
 }
 
-func NewRedisDb() (*RedisDb, error) {
+// NewRedisDb connects to addr. Every command but Subscribe is cancelled after timeout.
+func NewRedisDb(addr string, timeout time.Duration) (*RedisDb, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_URL"),
+		Addr:     addr,
 		Password: "", // no password set
 		DB:       0,  // use default DB
 	})
+	client.AddHook(metricsHook{})
+	client.AddHook(tracingHook{})
 
 	err := client.Ping(context.Background()).Err()
 
 	return &RedisDb{
-		client: client,
+		client:  client,
+		timeout: timeout,
 	}, err
 }
 
-func (r *RedisDb) Set(key string, value interface{}, expiration time.Duration) error {
-	return r.client.Set(context.Background(), key, value, expiration).Err()
+// withTimeout bounds a single command by the configured timeout.
+func (r *RedisDb) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+func (r *RedisDb) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisDb) Ping(ctx context.Context) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisDb) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Set(ctx, key, value, expiration).Err()
+}
+
+func (r *RedisDb) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Get(ctx, key).Result()
+}
+
+func (r *RedisDb) Delete(ctx context.Context, key string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	err := r.client.Del(ctx, key).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// Eval runs a Lua script atomically on the server.
+func (r *RedisDb) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Eval(ctx, script, keys, args...).Result()
+}
+
+func (r *RedisDb) Publish(ctx context.Context, channel string, message interface{}) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe delivers the payloads published to channel until ctx is done, when the
+// returned channel is closed.
+func (r *RedisDb) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	pubsub := r.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	payloads := make(chan string)
+	go func() {
+		defer close(payloads)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case payloads <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return payloads, nil
+}
+
+// Listen hands each payload published to channel to handle until ctx is done. It
+// resubscribes a second after a connection error, so a Redis restart only loses the
+// messages published meanwhile.
+func (r *RedisDb) Listen(ctx context.Context, logger *slog.Logger, channel string, handle func(payload string)) {
+	for ctx.Err() == nil {
+		payloads, err := r.Subscribe(ctx, channel)
+		if err != nil {
+			logger.Error("error subscribing", "channel", channel, "err", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		for payload := range payloads {
+			handle(payload)
+		}
+	}
+}
+
+type metricsStartKey struct{}
+
+// metricsHook observes the latency and errors of every Redis command. A missing key
+// is a result, not an error.
+type metricsHook struct{}
+
+func (metricsHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
 }
 
-func (r *RedisDb) Get(key string) (string, error) {
-	return r.client.Get(context.Background(), key).Result()
+func (metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if start, ok := ctx.Value(metricsStartKey{}).(time.Time); ok {
+		metrics.ObserveDatastore("redis", cmd.Name(), start, redisError(cmd.Err()))
+	}
+	return nil
+}
+
+func (metricsHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(metricsStartKey{}).(time.Time); ok {
+		var err error
+		for _, cmd := range cmds {
+			if err = redisError(cmd.Err()); err != nil {
+				break
+			}
+		}
+		metrics.ObserveDatastore("redis", "pipeline", start, err)
+	}
+	return nil
 }
 
-func (r *RedisDb) Delete(key string) error {
-	err := r.client.Del(context.Background(), key).Err()
+func redisError(err error) error {
 	if errors.Is(err, redis.Nil) {
 		return nil
 	}
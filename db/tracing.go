@@ -0,0 +1,109 @@
+package db
+
+import (
+	"TaskService/tracing"
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strings"
+)
+
+type spanKey struct{}
+
+func withSpan(ctx context.Context, span trace.Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// spanOf returns the span started by a hook for the call of ctx, not a parent one.
+func spanOf(ctx context.Context) trace.Span {
+	span, _ := ctx.Value(spanKey{}).(trace.Span)
+	return span
+}
+
+// queryTracer starts a client span for every Postgres query of a traced request.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, span := tracing.StartClient(ctx, "postgres.query",
+		semconv.DBSystemPostgreSQL, semconv.DBQueryText(data.SQL))
+	return withSpan(ctx, span)
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	err := data.Err
+	tracing.End(spanOf(ctx), &err)
+}
+
+// tracingHook starts a client span for every Redis command of a traced request.
+type tracingHook struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, span := tracing.StartClient(ctx, "redis."+cmd.Name(),
+		semconv.DBSystemRedis, semconv.DBOperationName(cmd.Name()))
+	return withSpan(ctx, span), nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	err := redisError(cmd.Err())
+	tracing.End(spanOf(ctx), &err)
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	ctx, span := tracing.StartClient(ctx, "redis.pipeline", semconv.DBSystemRedis)
+	return withSpan(ctx, span), nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = redisError(cmd.Err()); err != nil {
+			break
+		}
+	}
+	tracing.End(spanOf(ctx), &err)
+	return nil
+}
+
+// tracingTransport starts a client span for every Elasticsearch request of a traced request.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := esOperation(req)
+	ctx, span := tracing.StartClient(req.Context(), "elasticsearch."+operation,
+		semconv.DBSystemElasticsearch, semconv.DBOperationName(operation),
+		semconv.HTTPRequestMethodKey.String(req.Method), semconv.URLPath(req.URL.Path))
+	if span == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		if res.StatusCode >= 400 {
+			span.SetStatus(codes.Error, res.Status)
+		}
+	}
+	tracing.End(span, &err)
+	return res, err
+}
+
+// esOperation names a request by its API endpoint, e.g. "_search" for /post/_search,
+// falling back to the method for document and index requests.
+func esOperation(req *http.Request) string {
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if strings.HasPrefix(segment, "_") {
+			return strings.TrimPrefix(segment, "_")
+		}
+	}
+	return strings.ToLower(req.Method)
+}
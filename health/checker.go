@@ -0,0 +1,87 @@
+package health
+
+import (
+	"TaskService/models"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Check pings one dependency, e.g. a database.
+type Check struct {
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+type Checker struct {
+	checks  []Check
+	hard    map[string]bool
+	timeout time.Duration
+}
+
+// NewChecker runs checks with timeout each. Only the dependencies named in hard make
+// the instance not ready when they are down.
+func NewChecker(timeout time.Duration, hard []string, checks ...Check) (*Checker, error) {
+	c := &Checker{
+		checks:  checks,
+		hard:    make(map[string]bool, len(hard)),
+		timeout: timeout,
+	}
+	known := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		known[check.Name] = true
+	}
+	for _, name := range hard {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown dependency %q", name)
+		}
+		c.hard[name] = true
+	}
+	return c, nil
+}
+
+// Check pings every dependency concurrently.
+func (c *Checker) Check(ctx context.Context) models.Readiness {
+	readiness := models.Readiness{
+		Status:       models.ReadinessReady,
+		Dependencies: make(map[string]models.DependencyHealth, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			dependency := c.ping(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Dependencies[check.Name] = dependency
+			if dependency.Hard && dependency.Status == models.HealthDown {
+				readiness.Status = models.ReadinessNotReady
+			}
+		}(check)
+	}
+	wg.Wait()
+	return readiness
+}
+
+func (c *Checker) ping(ctx context.Context, check Check) models.DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Ping(ctx)
+	dependency := models.DependencyHealth{
+		Status:    models.HealthUp,
+		Hard:      c.hard[check.Name],
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		dependency.Status = models.HealthDown
+		dependency.Error = err.Error()
+	}
+	return dependency
+}
@@ -0,0 +1,119 @@
+package i18n
+
+import (
+	"errors"
+	"golang.org/x/text/language"
+	"net/http"
+	"strings"
+)
+
+// analyzers maps language codes to the Elasticsearch analyzer for their text.
+var analyzers = map[string]string{
+	"ar": "arabic",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"hi": "hindi",
+	"it": "italian",
+	"pt": "portuguese",
+	"ru": "russian",
+	"tr": "turkish",
+	"zh": "cjk",
+	"ja": "cjk",
+	"ko": "cjk",
+}
+
+// Languages are the content languages the service serves, with the language
+// base posts are written in as the default.
+type Languages struct {
+	Default   string
+	supported []string
+	matcher   language.Matcher
+}
+
+func NewLanguages(defaultLang string, supported []string) (*Languages, error) {
+	if defaultLang == "" {
+		return nil, errors.New("default language is empty")
+	}
+	all := []string{defaultLang}
+	for _, lang := range supported {
+		lang = strings.TrimSpace(lang)
+		if lang != "" && lang != defaultLang {
+			all = append(all, lang)
+		}
+	}
+
+	// The default goes first, so the matcher falls back to it.
+	tags := make([]language.Tag, len(all))
+	for i, lang := range all {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = tag
+	}
+
+	return &Languages{
+		Default:   defaultLang,
+		supported: all,
+		matcher:   language.NewMatcher(tags),
+	}, nil
+}
+
+// All returns the supported language codes, default first.
+func (l *Languages) All() []string {
+	return l.supported
+}
+
+func (l *Languages) Supported(lang string) bool {
+	for _, supported := range l.supported {
+		if supported == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick returns the language for the response: the "lang" query param when it is
+// supported, else the best match for Accept-Language, else the default. It adds
+// Accept-Language to the Vary header of w, so caches keep a response per language.
+func (l *Languages) Pick(w http.ResponseWriter, r *http.Request) string {
+	varyOnAcceptLanguage(w.Header())
+	if lang := r.URL.Query().Get("lang"); l.Supported(lang) {
+		return lang
+	}
+
+	accept := r.Header.Get("Accept-Language")
+	if accept == "" {
+		return l.Default
+	}
+	tags, _, err := language.ParseAcceptLanguage(accept)
+	if err != nil || len(tags) == 0 {
+		return l.Default
+	}
+	_, index, confidence := l.matcher.Match(tags...)
+	if confidence == language.No {
+		return l.Default
+	}
+	return l.supported[index]
+}
+
+func varyOnAcceptLanguage(header http.Header) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept-Language") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Language")
+}
+
+// Analyzer returns the Elasticsearch analyzer for lang, "standard" for unknown languages.
+func Analyzer(lang string) string {
+	if analyzer, ok := analyzers[lang]; ok {
+		return analyzer
+	}
+	return "standard"
+}
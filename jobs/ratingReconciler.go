@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"TaskService/live"
+	"TaskService/models"
+	"TaskService/storages"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RatingReconciler periodically recomputes post ratings from the vote table and
+// publishes the fixed ones to live viewers.
+type RatingReconciler struct {
+	logger             *slog.Logger
+	userPostRatingStor *storages.UserPostRatingStorage
+	postStor           *storages.PostStorage
+	ratingHub          *live.RatingHub
+	interval           time.Duration
+	cancel             context.CancelFunc
+	done               chan struct{}
+}
+
+func NewRatingReconciler(logger *slog.Logger, userPostRatingStor *storages.UserPostRatingStorage,
+	postStor *storages.PostStorage, ratingHub *live.RatingHub, interval time.Duration) *RatingReconciler {
+	return &RatingReconciler{
+		logger:             logger,
+		userPostRatingStor: userPostRatingStor,
+		postStor:           postStor,
+		ratingHub:          ratingHub,
+		interval:           interval,
+		done:               make(chan struct{}),
+	}
+}
+
+// RunOnce reconciles all ratings, reindexes the scores of fixed posts and logs every drift.
+func (j *RatingReconciler) RunOnce(ctx context.Context) ([]models.RatingDrift, error) {
+	drifts, err := j.userPostRatingStor.ReconcileRatings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, drift := range drifts {
+		j.logger.Info("fixed rating drift", "post", drift.PostId, "stored", drift.Old, "computed", drift.New)
+		if err := j.postStor.IndexScores(ctx, drift.PostId); err != nil {
+			j.logger.Error("error indexing scores", "post", drift.PostId, "err", err)
+		}
+		if err := j.ratingHub.Publish(ctx, drift.PostId, drift.New); err != nil {
+			j.logger.Error("error publishing rating", "post", drift.PostId, "err", err)
+		}
+	}
+	return drifts, nil
+}
+
+// Start runs the reconciler every interval until Stop is called.
+func (j *RatingReconciler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				drifts, err := j.RunOnce(ctx)
+				if err != nil {
+					j.logger.Error("error reconciling ratings", "err", err)
+					continue
+				}
+				j.logger.Info("reconciled ratings", "drifts", len(drifts))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancels the current run and waits for it to end. It returns ctx.Err() when ctx
+// is done first.
+func (j *RatingReconciler) Stop(ctx context.Context) error {
+	j.cancel()
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"TaskService/models"
+	"TaskService/notify"
+	"TaskService/storages"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// Reminders of a batch are sent one by one, so the lease outlasts a batch of timeouts
+	// and a slow batch is not claimed again while it is still being sent.
+	reminderBatch       = 20
+	reminderSendTimeout = 30 * time.Second
+	reminderLease       = reminderBatch*reminderSendTimeout + time.Minute
+	reminderMaxAttempts = 5
+)
+
+// reminderQueue is the part of storages.ReminderStorage the sender works with.
+type reminderQueue interface {
+	EnqueueDue(ctx context.Context) (int64, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.Reminder, error)
+	MarkSent(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, sendErr error, retryAt *time.Time) error
+}
+
+// ReminderSender periodically enqueues due deadline reminders and delivers them through
+// the channel. Delivery is at least once: a reminder is marked sent only after the channel
+// accepted it, and the channel gets the reminder id as the dedup key for redeliveries.
+type ReminderSender struct {
+	logger       *slog.Logger
+	reminderStor reminderQueue
+	channel      notify.Channel
+	interval     time.Duration
+	now          func() time.Time
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+func NewReminderSender(logger *slog.Logger, reminderStor *storages.ReminderStorage, channel notify.Channel,
+	interval time.Duration) *ReminderSender {
+	return &ReminderSender{
+		logger:       logger,
+		reminderStor: reminderStor,
+		channel:      channel,
+		interval:     interval,
+		now:          time.Now,
+		done:         make(chan struct{}),
+	}
+}
+
+// RunOnce enqueues due reminders and sends the claimed batch. It returns the number sent.
+func (j *ReminderSender) RunOnce(ctx context.Context) (int, error) {
+	enqueued, err := j.reminderStor.EnqueueDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if enqueued > 0 {
+		j.logger.Info("enqueued reminders", "count", enqueued)
+	}
+
+	reminders, err := j.reminderStor.ClaimDue(ctx, reminderBatch, reminderLease)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, reminder := range reminders {
+		if ctx.Err() != nil {
+			// Stopping; the rest are claimed again after the lease.
+			break
+		}
+		if j.send(ctx, reminder) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+func (j *ReminderSender) send(ctx context.Context, reminder models.Reminder) bool {
+	sendCtx, cancel := context.WithTimeout(ctx, reminderSendTimeout)
+	defer cancel()
+
+	err := j.channel.Send(sendCtx, notify.Message{
+		Key:    "reminder:" + reminder.Id,
+		UserId: reminder.UserId,
+		Text:   reminderText(reminder),
+	})
+	if err != nil {
+		var retryAt *time.Time
+		if reminder.Attempts < reminderMaxAttempts {
+			next := j.now().Add(time.Minute << reminder.Attempts)
+			retryAt = &next
+		}
+		j.logger.Error("error sending reminder", "channel", j.channel.Name(), "reminder", reminder.Id,
+			"attempt", reminder.Attempts, "err", err)
+		if err := j.reminderStor.MarkFailed(ctx, reminder.Id, err, retryAt); err != nil {
+			j.logger.Error("error marking reminder failed", "reminder", reminder.Id, "err", err)
+		}
+		return false
+	}
+
+	if err := j.reminderStor.MarkSent(ctx, reminder.Id); err != nil {
+		// The reminder is claimed again after the lease and resent with the same key.
+		j.logger.Error("error marking reminder sent", "reminder", reminder.Id, "err", err)
+	}
+	return true
+}
+
+func reminderText(reminder models.Reminder) string {
+	return fmt.Sprintf("Reminder: \"%s\" from \"%s\" is due %s.",
+		reminder.ItemTitle, reminder.ChecklistTitle, reminder.Deadline.Format("02.01.2006 15:04 MST"))
+}
+
+// Start runs the sender every interval until Stop is called.
+func (j *ReminderSender) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sent, err := j.RunOnce(ctx)
+				if err != nil {
+					j.logger.Error("error sending reminders", "err", err)
+					continue
+				}
+				if sent > 0 {
+					j.logger.Info("sent reminders", "count", sent)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancels the current run and waits for it to end. It returns ctx.Err() when ctx
+// is done first.
+func (j *ReminderSender) Stop(ctx context.Context) error {
+	j.cancel()
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"TaskService/models"
+	"TaskService/notify"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeReminderQueue hands out the same due reminders on every claim, as the storage
+// does for reminders whose lease expired before they were marked sent.
+type fakeReminderQueue struct {
+	due        []models.Reminder
+	markSent   error
+	sent       []string
+	failed     map[string]*time.Time
+	failedErrs map[string]error
+}
+
+func newFakeReminderQueue(due ...models.Reminder) *fakeReminderQueue {
+	return &fakeReminderQueue{due: due, failed: map[string]*time.Time{}, failedErrs: map[string]error{}}
+}
+
+func (q *fakeReminderQueue) EnqueueDue(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (q *fakeReminderQueue) ClaimDue(context.Context, int, time.Duration) ([]models.Reminder, error) {
+	return q.due, nil
+}
+
+func (q *fakeReminderQueue) MarkSent(_ context.Context, id string) error {
+	q.sent = append(q.sent, id)
+	return q.markSent
+}
+
+func (q *fakeReminderQueue) MarkFailed(_ context.Context, id string, sendErr error, retryAt *time.Time) error {
+	q.failed[id] = retryAt
+	q.failedErrs[id] = sendErr
+	return nil
+}
+
+// flakyChannel fails the first failures sends, then delivers through the log channel.
+type flakyChannel struct {
+	*notify.LogChannel
+	failures int
+}
+
+func (c *flakyChannel) Send(ctx context.Context, msg notify.Message) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("channel unavailable")
+	}
+	return c.LogChannel.Send(ctx, msg)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newTestSender(queue *fakeReminderQueue, channel notify.Channel, now time.Time) *ReminderSender {
+	sender := NewReminderSender(testLogger(), nil, channel, time.Minute)
+	sender.reminderStor = queue
+	sender.now = func() time.Time { return now }
+	return sender
+}
+
+func testReminder(id string, attempts int) models.Reminder {
+	return models.Reminder{
+		Id:             id,
+		UserId:         42,
+		ItemTitle:      "Submit documents",
+		ChecklistTitle: "Before Sept 1",
+		Deadline:       time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC),
+		Attempts:       attempts,
+	}
+}
+
+func TestReminderSenderDedupsRedelivery(t *testing.T) {
+	// Marking sent fails, so the reminder is claimed again after its lease.
+	queue := newFakeReminderQueue(testReminder("r1", 1))
+	queue.markSent = errors.New("connection reset")
+	channel := notify.NewLogChannel(testLogger())
+	sender := newTestSender(queue, channel, time.Now())
+
+	for run := 0; run < 2; run++ {
+		if _, err := sender.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := channel.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("user got %d messages, want 1", len(sent))
+	}
+	if sent[0].Key != "reminder:r1" || sent[0].UserId != 42 {
+		t.Errorf("message = %+v", sent[0])
+	}
+	if len(queue.sent) != 2 {
+		t.Errorf("marked sent %d times, want on every delivery", len(queue.sent))
+	}
+}
+
+func TestReminderSenderBacksOff(t *testing.T) {
+	now := time.Date(2026, 8, 30, 9, 0, 0, 0, time.UTC)
+	queue := newFakeReminderQueue(
+		testReminder("first", 1),
+		testReminder("third", 3),
+		testReminder("last", reminderMaxAttempts),
+	)
+	channel := &flakyChannel{LogChannel: notify.NewLogChannel(testLogger()), failures: 3}
+	sender := newTestSender(queue, channel, now)
+
+	sent, err := sender.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 0 {
+		t.Errorf("sent %d, want 0", sent)
+	}
+	for id, want := range map[string]time.Duration{"first": 2 * time.Minute, "third": 8 * time.Minute} {
+		retryAt := queue.failed[id]
+		if retryAt == nil || !retryAt.Equal(now.Add(want)) {
+			t.Errorf("%s retries at %v, want %v", id, retryAt, now.Add(want))
+		}
+	}
+	if retryAt, ok := queue.failed["last"]; !ok || retryAt != nil {
+		t.Errorf("last attempt retries at %v, want to give up", retryAt)
+	}
+	if queue.failedErrs["first"] == nil {
+		t.Error("the send error isn't recorded")
+	}
+
+	// The channel is back: the retried reminders go out once each.
+	queue.due = queue.due[:2]
+	if sent, err := sender.RunOnce(context.Background()); err != nil || sent != 2 {
+		t.Fatalf("retry sent %d, %v, want 2", sent, err)
+	}
+	if got := len(channel.Sent()); got != 2 {
+		t.Errorf("user got %d messages, want 2", got)
+	}
+}
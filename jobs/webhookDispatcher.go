@@ -0,0 +1,197 @@
+package jobs
+
+import (
+	"TaskService/models"
+	"TaskService/storages"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// Deliveries of a batch are sent one by one, so the lease outlasts a batch of timeouts
+	// and a slow batch is not claimed again while it is still being sent.
+	webhookBatch       = 10
+	webhookTimeout     = 10 * time.Second
+	webhookLease       = webhookBatch*webhookTimeout + 30*time.Second
+	webhookMaxAttempts = 8
+	webhookBackoff     = 30 * time.Second
+)
+
+// WebhookDispatcher periodically sends queued webhook deliveries. Every request carries
+//
+//	X-Webhook-Event:     the event, e.g. post.created
+//	X-Webhook-Delivery:  the delivery id, the same for retries
+//	X-Webhook-Timestamp: unix seconds of the attempt
+//	X-Webhook-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret>
+//
+// Any 2xx answer completes the delivery; anything else is retried with exponential backoff.
+type WebhookDispatcher struct {
+	logger      *slog.Logger
+	webhookStor *storages.WebhookStorage
+	client      *http.Client
+	interval    time.Duration
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewWebhookDispatcher(logger *slog.Logger, webhookStor *storages.WebhookStorage, interval time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		logger:      logger,
+		webhookStor: webhookStor,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: &http.Transport{DialContext: publicDialer().DialContext},
+			// A redirect would turn the POST into a GET without the payload; report it instead.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// errPrivateAddress is returned for webhooks resolving to an address of this network.
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// publicDialer refuses loopback, private, link-local and unspecified addresses, so a
+// webhook cannot reach services inside the network. The check runs on the resolved
+// address of each connection, which a DNS name changing between requests cannot evade.
+func publicDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			addr := addrPort.Addr().Unmap()
+			if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+				addr.IsLinkLocalMulticast() || addr.IsUnspecified() {
+				return fmt.Errorf("%w: %s", errPrivateAddress, addr)
+			}
+			return nil
+		},
+	}
+}
+
+// RunOnce sends the claimed batch and returns the number delivered.
+func (j *WebhookDispatcher) RunOnce(ctx context.Context) (int, error) {
+	deliveries, err := j.webhookStor.ClaimDue(ctx, webhookBatch, webhookLease)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			// Stopping; the rest are claimed again after the lease.
+			break
+		}
+		if j.deliver(ctx, delivery) {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+func (j *WebhookDispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) bool {
+	responseCode, err := j.send(ctx, delivery)
+
+	var retryAt *time.Time
+	if err != nil {
+		j.logger.Error("error delivering webhook", "delivery", delivery.Id, "attempt", delivery.Attempts, "err", err)
+		if delivery.Attempts < webhookMaxAttempts {
+			next := time.Now().Add(webhookBackoff << (delivery.Attempts - 1))
+			retryAt = &next
+		}
+	}
+	if err := j.webhookStor.RecordAttempt(ctx, delivery.Id, responseCode, err, retryAt); err != nil {
+		// The delivery is claimed again after the lease.
+		j.logger.Error("error recording webhook attempt", "delivery", delivery.Id, "err", err)
+	}
+	return err == nil
+}
+
+func (j *WebhookDispatcher) send(ctx context.Context, delivery models.WebhookDelivery) (*int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TaskService-Webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return &resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>", which receivers recompute to verify a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start runs the dispatcher every interval until Stop is called.
+func (j *WebhookDispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				delivered, err := j.RunOnce(ctx)
+				if err != nil {
+					j.logger.Error("error dispatching webhooks", "err", err)
+					continue
+				}
+				if delivered > 0 {
+					j.logger.Info("delivered webhooks", "count", delivered)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancels the current run and waits for it to end. It returns ctx.Err() when ctx
+// is done first.
+func (j *WebhookDispatcher) Stop(ctx context.Context) error {
+	j.cancel()
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
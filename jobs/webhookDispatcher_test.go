@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached a loopback server")
+	}))
+	defer server.Close()
+
+	client := NewWebhookDispatcher(nil, nil, 0).client
+	for _, url := range []string{server.URL, "http://10.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]:1/hook"} {
+		resp, err := client.Post(url, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("POST %s: want an error", url)
+			continue
+		}
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("POST %s: err = %v, want errPrivateAddress", url, err)
+		}
+	}
+}
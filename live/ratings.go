@@ -0,0 +1,224 @@
+package live
+
+import (
+	"TaskService/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+const ratingsChannel = "ratings"
+
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrTooManyPosts       = errors.New("too many subscribed posts")
+)
+
+// RatingEvent is sent to the subscribers of a post when its rating changes.
+type RatingEvent struct {
+	Id     string `json:"id"`
+	Rating int    `json:"rating"`
+}
+
+type Limits struct {
+	// MaxConns caps the subscribers of one instance, MaxConnsPerKey those of one client.
+	MaxConns       int
+	MaxConnsPerKey int
+	// MaxPosts caps the posts one subscriber watches.
+	MaxPosts int
+}
+
+func DefaultLimits() Limits {
+	return Limits{MaxConns: 10000, MaxConnsPerKey: 10, MaxPosts: 100}
+}
+
+// RatingHub sends rating changes to the clients watching the post, whichever instance
+// they are connected to, by relaying them through Redis.
+type RatingHub struct {
+	logger *slog.Logger
+	redis  *db.RedisDb
+	limits Limits
+	mu     sync.Mutex
+	subs   map[string]map[*Subscriber]struct{}
+	conns  int
+	keys   map[string]int
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRatingHub(logger *slog.Logger, redis *db.RedisDb, limits Limits) *RatingHub {
+	return &RatingHub{
+		logger: logger,
+		redis:  redis,
+		limits: limits,
+		subs:   make(map[string]map[*Subscriber]struct{}),
+		keys:   make(map[string]int),
+		done:   make(chan struct{}),
+	}
+}
+
+func (h *RatingHub) Publish(ctx context.Context, id string, rating int) error {
+	payload, err := json.Marshal(RatingEvent{Id: id, Rating: rating})
+	if err != nil {
+		return err
+	}
+	return h.redis.Publish(ctx, ratingsChannel, payload)
+}
+
+// Connect registers a subscriber of the client identified by key, e.g. its IP.
+// The subscriber must be closed when the client goes away.
+func (h *RatingHub) Connect(key string) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns >= h.limits.MaxConns {
+		return nil, ErrTooManyConnections
+	}
+	if h.keys[key] >= h.limits.MaxConnsPerKey {
+		return nil, ErrTooManyConnections
+	}
+	h.conns++
+	h.keys[key]++
+
+	return &Subscriber{
+		hub:     h,
+		key:     key,
+		posts:   make(map[string]struct{}),
+		pending: make(map[string]int),
+		ready:   make(chan struct{}, 1),
+	}, nil
+}
+
+func (h *RatingHub) dispatch(event RatingEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[event.Id] {
+		sub.push(event)
+	}
+}
+
+// Start relays the rating changes of every instance until Stop is called.
+func (h *RatingHub) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		defer close(h.done)
+		h.redis.Listen(ctx, h.logger, ratingsChannel, func(payload string) {
+			var event RatingEvent
+			if err := json.Unmarshal([]byte(payload), &event); err != nil {
+				h.logger.Warn("error decoding rating event", "err", err)
+				return
+			}
+			h.dispatch(event)
+		})
+	}()
+}
+
+func (h *RatingHub) Stop() {
+	h.cancel()
+	<-h.done
+}
+
+// Stopped is closed once the hub stops, so that handlers can close their connections.
+func (h *RatingHub) Stopped() <-chan struct{} {
+	return h.done
+}
+
+// Subscriber receives the rating changes of the posts it watches. Events are not queued:
+// only the latest rating of every post waits to be sent, so a slow client skips the
+// intermediate values instead of growing a backlog.
+type Subscriber struct {
+	hub     *RatingHub
+	key     string
+	posts   map[string]struct{}
+	pending map[string]int
+	ready   chan struct{}
+	once    sync.Once
+}
+
+// Watch adds posts to the subscription, failing without changes if it would watch too many.
+func (s *Subscriber) Watch(ids []string) error {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	added := 0
+	for _, id := range ids {
+		if _, ok := s.posts[id]; !ok {
+			added++
+		}
+	}
+	if len(s.posts)+added > h.limits.MaxPosts {
+		return ErrTooManyPosts
+	}
+	for _, id := range ids {
+		s.posts[id] = struct{}{}
+		if h.subs[id] == nil {
+			h.subs[id] = make(map[*Subscriber]struct{})
+		}
+		h.subs[id][s] = struct{}{}
+	}
+	return nil
+}
+
+func (s *Subscriber) Unwatch(ids []string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for _, id := range ids {
+		s.unwatch(id)
+	}
+}
+
+func (s *Subscriber) unwatch(id string) {
+	h := s.hub
+	delete(s.posts, id)
+	delete(s.pending, id)
+	delete(h.subs[id], s)
+	if len(h.subs[id]) == 0 {
+		delete(h.subs, id)
+	}
+}
+
+// push is called with the hub locked.
+func (s *Subscriber) push(event RatingEvent) {
+	s.pending[event.Id] = event.Rating
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready is signalled when there are events to take.
+func (s *Subscriber) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Take returns the pending events, the latest one per post.
+func (s *Subscriber) Take() []RatingEvent {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	events := make([]RatingEvent, 0, len(s.pending))
+	for id, rating := range s.pending {
+		events = append(events, RatingEvent{Id: id, Rating: rating})
+		delete(s.pending, id)
+	}
+	return events
+}
+
+// Close unwatches every post and frees the connection slot.
+func (s *Subscriber) Close() {
+	s.once.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for id := range s.posts {
+			s.unwatch(id)
+		}
+		h.conns--
+		h.keys[s.key]--
+		if h.keys[s.key] == 0 {
+			delete(h.keys, s.key)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type loggerKey struct{}
+
+// New returns a JSON logger writing to w. level is one of debug, info, warn and error,
+// info when empty or unknown.
+func New(w io.Writer, level string) *slog.Logger {
+	var leveler slog.Level
+	if err := leveler.UnmarshalText([]byte(level)); err != nil {
+		leveler = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: leveler}))
+}
+
+// WithLogger returns a context carrying the logger, e.g. one scoped to a request.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the context, or the default logger when it has none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Fatal logs the error and exits, the slog counterpart of log.Fatal.
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Redact keeps enough of a secret, like a token, to tell values apart in logs.
+func Redact(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + "..." + secret[len(secret)-2:]
+}
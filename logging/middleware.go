@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"TaskService/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// Middleware scopes a logger to every request. It takes the request id from the
+// X-Request-ID header, generating one when missing or malformed, echoes it in the
+// response and logs the outcome of the request. Query strings are not logged,
+// since they may carry session tokens.
+func Middleware(base *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			logger := base.With("requestId", requestID)
+			sw := response.Wrap(w)
+			next.ServeHTTP(sw, r.WithContext(WithLogger(r.Context(), logger)))
+
+			route := ""
+			if current := mux.CurrentRoute(r); current != nil {
+				route, _ = current.GetPathTemplate()
+			}
+			level := slog.LevelInfo
+			if sw.Status >= 500 {
+				level = slog.LevelError
+			}
+			logger.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", route,
+				"status", sw.Status,
+				"bytes", sw.Bytes,
+				"durationMs", time.Since(start).Milliseconds())
+		})
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
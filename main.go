@@ -1,78 +1,361 @@
 package main
 
 import (
+	"TaskService/config"
 	"TaskService/controllers"
 	"TaskService/db"
+	"TaskService/health"
+	"TaskService/i18n"
+	"TaskService/jobs"
+	"TaskService/live"
+	"TaskService/logging"
+	"TaskService/media"
+	"TaskService/metrics"
+	"TaskService/notify"
+	"TaskService/openapi"
+	"TaskService/problem"
+	"TaskService/ratelimit"
 	"TaskService/storages"
+	"TaskService/tracing"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
-	"log"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 func main() {
 	_ = godotenv.Load()
 
+	// CONFIG_FILE is the only setting outside the config, as it points to it.
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		logging.Fatal(logging.New(os.Stdout, ""), "can't load config", "err", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		printConfig(cfg)
+		return
+	}
+
 	app := app{
 		router: mux.NewRouter(),
-		server: &http.Server{},
-		logger: log.New(os.Stdout, "web ", log.LstdFlags),
+		server: &http.Server{
+			ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+			ReadTimeout:       cfg.HTTP.ReadTimeout,
+			WriteTimeout:      cfg.HTTP.WriteTimeout,
+			IdleTimeout:       cfg.HTTP.IdleTimeout,
+		},
+		logger: logging.New(os.Stdout, cfg.Log.Level),
+	}
+	slog.SetDefault(app.logger)
+	app.logger.Info("loaded config", "config", cfg.Redacted())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, os.Stdout)
+	if err != nil {
+		logging.Fatal(app.logger, "can't set up tracing", "err", err)
 	}
 
+	app.router.Use(logging.Middleware(app.logger))
+	app.router.Use(tracing.Middleware)
+	app.router.Use(metrics.Middleware)
 	app.router.Use(corsMiddleware)
 
 	app.router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			app.logger.Println("Request on url: ", r.URL.String())
-			if !strings.HasPrefix(r.URL.String(), "/acc/verify") {
-				app.logger.Println("Setting content-type to json")
+			if !strings.HasPrefix(r.URL.Path, "/acc/verify") && !strings.HasPrefix(r.URL.Path, "/media/files/") {
 				w.Header().Add("Content-Type", "application/json")
 			}
 			next.ServeHTTP(w, r)
 		})
 	})
 
+	app.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.New(http.StatusNotFound, problem.RouteNotFound, "").Write(w)
+	})
+	app.router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.New(http.StatusMethodNotAllowed, problem.MethodNotAllowed, "").Write(w)
+	})
+
 	app.router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if c, err := r.Cookie("session_token"); err != nil {
-			app.logger.Println("Got token in '/': ", c)
+		logger := logging.FromContext(r.Context())
+		if _, err := r.Cookie("session_token"); err == nil {
+			logger.Debug("got session cookie in '/'")
 		} else {
-			app.logger.Println("Got no cookie in '/'")
+			logger.Warn("got no cookie in '/'")
 		}
 	})
 
-	base := db.Init(app.logger)
-	defer base.Close()
+	base := db.Init(app.logger, cfg.Postgres.URL, cfg.Postgres.Timeout)
+	prometheus.MustRegister(metrics.NewPoolCollector(base.Conn))
+	openapi.Register(app.router)
 
-	app.logger.Println("Redis url: ", os.Getenv("REDIS_URL"))
-	redis, err := db.NewRedisDb()
+	redis, err := db.NewRedisDb(cfg.Redis.Addr, cfg.Redis.Timeout)
 	if err != nil {
-		app.logger.Fatal("Can't connect to redis")
+		logging.Fatal(app.logger, "can't connect to redis", "err", err)
 	} else {
-		app.logger.Println("Connected to redis")
+		app.logger.Info("connected to redis")
 	}
 
-	es := db.NewEsDb(app.logger)
+	es := db.NewEsDb(app.logger, cfg.Elasticsearch.Addresses, cfg.Elasticsearch.Timeout)
 
-	postStorage := storages.NewPostStorage(app.logger, base.Conn, es)
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		reconcileRatings(app.logger, cfg, base, redis, es)
+		base.Close()
+		return
+	}
+
+	hc := controllers.NewHealthController(newHealthChecker(app.logger, cfg.Ready, base, redis, es))
+	hc.Register("", app.router)
+
+	langs := newLanguages(app.logger, cfg.Languages)
+	webhookStorage := storages.NewWebhookStorage(app.logger, base.Conn)
+	postStorage := storages.NewPostStorage(app.logger, base.Conn, es, langs, webhookStorage)
 	sessionStorage := storages.NewSessionStorage(redis, app.logger)
-	userPostRatingStorage := storages.NewUserPostRatingStorage(app.logger, base.Conn)
+	userPostRatingStorage := storages.NewUserPostRatingStorage(app.logger, base.Conn, storages.DefaultVoteAnomalyRules())
+	bookmarkStorage := storages.NewBookmarkStorage(app.logger, base.Conn)
+	mediaStorage := storages.NewMediaStorage(app.logger, base.Conn, newMediaStore(app.logger, cfg.Media, app.router))
+	translationStorage := storages.NewTranslationStorage(app.logger, base.Conn)
+	checklistStorage := storages.NewChecklistStorage(app.logger, base.Conn)
+	reminderStorage := storages.NewReminderStorage(app.logger, base.Conn)
+	notificationStorage := storages.NewNotificationStorage(app.logger, base.Conn)
+
+	broker := notify.NewBroker(app.logger, redis)
+	broker.Start()
+	// Stopping the broker and the hub ends the event streams and WebSockets, which
+	// would otherwise keep the server from draining.
+	app.server.RegisterOnShutdown(broker.Stop)
+	notifier := notify.NewNotifier(app.logger, notificationStorage, broker)
+
+	ratingHub := live.NewRatingHub(app.logger, redis, live.DefaultLimits())
+	ratingHub.Start()
+	app.server.RegisterOnShutdown(ratingHub.Stop)
+
+	trustedProxies, err := ratelimit.ParseTrustedProxies(strings.Join(cfg.HTTP.TrustedProxies, ","))
+	if err != nil {
+		logging.Fatal(app.logger, "invalid trusted proxies", "err", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewRedisBackend(redis), rateLimitGroups(app.logger, cfg.RateLimits),
+		ratelimit.SessionOrIPKey(sessionStorage, trustedProxies))
+	app.router.Use(limiter.Middleware)
+
+	pc := controllers.NewPostController(postStorage, sessionStorage, userPostRatingStorage, bookmarkStorage,
+		mediaStorage, translationStorage, langs, notifier, ratingHub)
+	ac := controllers.NewAccountController(sessionStorage, postStorage, bookmarkStorage, userPostRatingStorage,
+		mediaStorage, translationStorage, langs, cfg.Auth)
+	openapi.RegisterDocumented(app.router, pc, ac)
 
-	pc := controllers.NewPostController(app.logger, postStorage, sessionStorage, userPostRatingStorage)
-	pc.Register("/post", app.router)
+	mdc := controllers.NewMediaController(mediaStorage, sessionStorage, cfg.Media.MaxBytes)
+	mdc.Register("/media", app.router)
 
-	ac := controllers.NewAccountController(app.logger, sessionStorage)
-	ac.Register("/acc", app.router)
+	admins := idSet(cfg.Access.Admins)
+	mc := controllers.NewModerationController(sessionStorage, userPostRatingStorage, postStorage, admins, notifier,
+		ratingHub)
+	mc.Register("/admin", app.router)
 
-	app.ListenAndServe(":8080")
+	wc := controllers.NewWebhookController(webhookStorage, sessionStorage, admins)
+	wc.Register("/admin/webhooks", app.router)
+
+	editors := idSet(cfg.Access.Editors)
+	for id := range admins {
+		editors[id] = true
+	}
+	tc := controllers.NewTranslationController(postStorage, translationStorage, sessionStorage, langs, editors)
+	tc.Register("/post", app.router)
+
+	clc := controllers.NewChecklistController(checklistStorage, postStorage, sessionStorage, editors)
+	clc.Register("/checklists", app.router)
+
+	rc := controllers.NewReminderController(reminderStorage, sessionStorage)
+	rc.Register("/reminders", app.router)
+
+	nc := controllers.NewNotificationController(notificationStorage, sessionStorage, broker)
+	nc.Register("/notifications", app.router)
+
+	lc := controllers.NewLiveController(ratingHub, trustedProxies)
+	lc.Register("/ws", app.router)
+
+	reconciler := jobs.NewRatingReconciler(app.logger, userPostRatingStorage, postStorage, ratingHub,
+		cfg.Reconcile.Interval)
+	reconciler.Start()
+
+	reminderSender := jobs.NewReminderSender(app.logger, reminderStorage, newReminderChannel(app.logger, cfg.Reminders),
+		cfg.Reminders.Interval)
+	reminderSender.Start()
+
+	webhookDispatcher := jobs.NewWebhookDispatcher(app.logger, webhookStorage, cfg.Webhooks.Interval)
+	webhookDispatcher.Start()
+
+	metricsServer := serveMetrics(app.logger, cfg.HTTP.MetricsAddr)
+	app.OnStop("metrics server", metricsServer.Shutdown)
+	app.OnStop("rating reconciler", reconciler.Stop)
+	app.OnStop("reminder sender", reminderSender.Stop)
+	app.OnStop("webhook dispatcher", webhookDispatcher.Stop)
+	app.OnStop("tracing", shutdownTracing)
+	app.OnStop("postgres", stopping(base.Close))
+	app.OnStop("redis", closing(redis.Close))
+	app.OnStop("elasticsearch", stopping(es.Close))
+
+	if err := app.Run(cfg.HTTP.Addr, cfg.HTTP.ShutdownTimeout); err != nil {
+		os.Exit(1)
+	}
+}
+
+// printConfig is the "config" command: it prints the effective config, secrets redacted.
+func printConfig(cfg *config.Config) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		os.Exit(1)
+	}
+}
+
+// rateLimitGroups returns the limited route groups with the limits overridden in the config.
+func rateLimitGroups(logger *slog.Logger, overrides config.RateLimits) []ratelimit.Group {
+	groups := []ratelimit.Group{
+		{Name: "search", Limit: ratelimit.Limit{Rate: 1, Burst: 10}, Routes: []string{"GET /post/search"}},
+		{Name: "vote", Limit: ratelimit.Limit{Rate: 0.5, Burst: 10}, Routes: []string{
+			"PUT /post/{id}/inc", "PUT /post/{id}/dec", "PUT /post/{id}/vote",
+		}},
+		{Name: "default", Limit: ratelimit.Limit{Rate: 10, Burst: 50}},
+	}
+	values := map[string]string{
+		"search":  overrides.Search,
+		"vote":    overrides.Vote,
+		"default": overrides.Default,
+	}
+	for i := range groups {
+		value := values[groups[i].Name]
+		if value == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			logging.Fatal(logger, "invalid rate limit", "group", groups[i].Name, "err", err)
+		}
+		groups[i].Limit = limit
+	}
+	return groups
+}
+
+// newLanguages returns the content languages: the default one, which base posts are
+// written in, and the supported ones that posts can be translated into.
+func newLanguages(logger *slog.Logger, conf config.Languages) *i18n.Languages {
+	langs, err := i18n.NewLanguages(conf.Default, conf.Supported)
+	if err != nil {
+		logging.Fatal(logger, "invalid languages", "err", err)
+	}
+	return langs
+}
+
+// newHealthChecker checks Postgres, Redis and Elasticsearch, each within the ready timeout.
+// The hard dependencies make the app not ready when down.
+func newHealthChecker(logger *slog.Logger, conf config.Ready, base *db.PostgresDb, redis *db.RedisDb,
+	es *db.EsDb) *health.Checker {
+	checker, err := health.NewChecker(conf.Timeout, conf.HardDependencies,
+		health.Check{Name: "postgres", Ping: base.Ping},
+		health.Check{Name: "redis", Ping: redis.Ping},
+		health.Check{Name: "elasticsearch", Ping: es.Ping})
+	if err != nil {
+		logging.Fatal(logger, "invalid ready hard dependencies", "err", err)
+	}
+	return checker
+}
+
+// newMediaStore picks the media backend: "s3" for an S3-compatible bucket, "local" for
+// files under the media dir served by the app at /media/files.
+func newMediaStore(logger *slog.Logger, conf config.Media, router *mux.Router) media.Store {
+	if conf.Backend == "s3" {
+		return media.NewS3Store(media.S3Config{
+			Endpoint:  conf.S3.Endpoint,
+			Bucket:    conf.S3.Bucket,
+			Region:    conf.S3.Region,
+			AccessKey: conf.S3.AccessKey,
+			SecretKey: conf.S3.SecretKey,
+			PublicURL: conf.S3.PublicURL,
+		})
+	}
+
+	store, err := media.NewLocalStore(conf.Dir, conf.PublicURL+"/media/files")
+	if err != nil {
+		logging.Fatal(logger, "can't create media dir", "err", err)
+	}
+	router.PathPrefix("/media/files/").Handler(
+		http.StripPrefix("/media/files/", store.Handler()))
+	return store
+}
+
+// newReminderChannel picks the reminder channel: "vk" to message users from the community
+// of the group token, "log" to only log reminders.
+func newReminderChannel(logger *slog.Logger, conf config.Reminders) notify.Channel {
+	if conf.Channel != "vk" {
+		return notify.NewLogChannel(logger)
+	}
+	channel, err := notify.NewVkChannel(conf.VkGroupToken)
+	if err != nil {
+		logging.Fatal(logger, "can't create vk reminder channel", "err", err)
+	}
+	return channel
+}
+
+// idSet turns a list of VK ids, e.g. of moderators or editors, into a set.
+func idSet(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// serveMetrics serves /metrics on addr, apart from the API router, so the metrics are
+// not public wherever the API is.
+func serveMetrics(logger *slog.Logger, addr string) *http.Server {
+	router := http.NewServeMux()
+	router.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: router, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		logger.Info("metrics listening", "addr", addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("can't serve metrics", "err", err)
+		}
+	}()
+	return server
+}
+
+// reconcileRatings is the "reconcile" command: it fixes rating drift once and reports it,
+// then reindexes the scores of every post, which fills score fields added since.
+func reconcileRatings(logger *slog.Logger, cfg *config.Config, base *db.PostgresDb, redis *db.RedisDb, es *db.EsDb) {
+	postStorage := storages.NewPostStorage(logger, base.Conn, es, newLanguages(logger, cfg.Languages),
+		storages.NewWebhookStorage(logger, base.Conn))
+	userPostRatingStorage := storages.NewUserPostRatingStorage(logger, base.Conn, storages.DefaultVoteAnomalyRules())
+	// The hub only publishes here, so the running instances update their live viewers.
+	ratingHub := live.NewRatingHub(logger, redis, live.DefaultLimits())
+	drifts, err := jobs.NewRatingReconciler(logger, userPostRatingStorage, postStorage, ratingHub, 0).
+		RunOnce(context.Background())
+	if err != nil {
+		logging.Fatal(logger, "error reconciling ratings", "err", err)
+	}
+	logger.Info("reconciled ratings", "drifts", len(drifts))
+	reindexed, err := postStorage.ReindexScores(context.Background())
+	if err != nil {
+		logging.Fatal(logger, "error reindexing scores", "err", err)
+	}
+	logger.Info("reindexed scores", "posts", reindexed)
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Session-Token, traceparent, tracestate, "+
+			logging.RequestIDHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, "+
+			logging.RequestIDHeader)
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
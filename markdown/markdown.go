@@ -0,0 +1,46 @@
+package markdown
+
+import (
+	"bytes"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"html"
+	"strings"
+)
+
+var (
+	md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	// policy is the allowlist of tags and attributes the rendered HTML may keep.
+	// Raw HTML in the source is dropped by goldmark already; the policy also
+	// guards against javascript: links and other injection through Markdown.
+	policy = func() *bluemonday.Policy {
+		p := bluemonday.UGCPolicy()
+		p.AllowURLSchemes("http", "https", "mailto")
+		p.RequireNoFollowOnLinks(true)
+		p.AddTargetBlankToFullyQualifiedLinks(true)
+		return p
+	}()
+
+	textPolicy = bluemonday.StrictPolicy()
+)
+
+// ToHTML renders Markdown source to sanitized HTML.
+func ToHTML(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// ToPlainText strips Markdown syntax and returns the readable text, for search indexing.
+func ToPlainText(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	text := html.UnescapeString(textPolicy.Sanitize(buf.String()))
+	return strings.Join(strings.Fields(text), " "), nil
+}
@@ -0,0 +1,90 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "media"), "http://localhost:8080/media/files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "2f1c/thumb.png"
+
+	if err := store.Put(context.Background(), key, "image/png", strings.NewReader("png bytes"), 9); err != nil {
+		t.Fatal(err)
+	}
+	body, contentType, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "png bytes" || contentType != "image/png" {
+		t.Errorf("Get() = %q, %q", data, contentType)
+	}
+	if got, want := store.URL(key), "http://localhost:8080/media/files/"+key; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Get(context.Background(), key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+}
+
+func TestLocalStoreKeepsKeysInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "media"), "/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "../../escaped.txt", "text/plain", strings.NewReader("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "media", "escaped.txt")); err != nil {
+		t.Errorf("object isn't under the store dir: %v", err)
+	}
+}
+
+func TestLocalStoreHandlerServesObjectsOnly(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "2f1c/thumb.png", "image/png", strings.NewReader("png bytes"), 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2f1c", ".upload-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{
+		"/2f1c/thumb.png":   http.StatusOK,
+		"/":                 http.StatusNotFound,
+		"/2f1c/":            http.StatusNotFound,
+		"/2f1c":             http.StatusNotFound,
+		"/2f1c/.upload-123": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		store.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("media object not found")
+
+// Store keeps media objects by key, e.g. "<media id>/thumb.jpg". Calls stop when ctx is done.
+type Store interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns the public address of the object.
+	URL(key string) string
+}
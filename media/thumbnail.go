@@ -0,0 +1,137 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Size is a rendition of an uploaded image. A zero MaxSide keeps the original.
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+var Sizes = []Size{
+	{Name: "original"},
+	{Name: "medium", MaxSide: 1024},
+	{Name: "thumb", MaxSide: 256},
+}
+
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+// MaxPixels caps width x height of an upload. A small file can declare a huge image,
+// and decoding allocates for every pixel.
+const MaxPixels = 40_000_000
+
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// AllowedTypes maps the sniffed content types accepted for upload to file extensions.
+var AllowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// SniffType detects the content type from the first bytes of data,
+// ignoring whatever the client claimed.
+func SniffType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := AllowedTypes[contentType]; !ok {
+		return contentType, ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Rendition is an encoded image of one Size.
+type Rendition struct {
+	Size        Size
+	ContentType string
+	Ext         string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+// Render decodes data and returns every size, downscaled in pure Go. The original
+// is kept byte for byte; resized copies are PNG for PNG sources and JPEG otherwise.
+// Images above MaxPixels are refused with ErrTooManyPixels before they are decoded.
+func Render(data []byte, contentType string) ([]Rendition, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+
+	renditions := make([]Rendition, 0, len(Sizes))
+	for _, size := range Sizes {
+		if size.MaxSide == 0 {
+			renditions = append(renditions, Rendition{
+				Size:        size,
+				ContentType: contentType,
+				Ext:         AllowedTypes[contentType],
+				Data:        data,
+				Width:       bounds.Dx(),
+				Height:      bounds.Dy(),
+			})
+			continue
+		}
+
+		resized := resize(src, size.MaxSide)
+		var buf bytes.Buffer
+		rendition := Rendition{Size: size, Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy()}
+		if contentType == "image/png" {
+			err = png.Encode(&buf, resized)
+			rendition.ContentType, rendition.Ext = "image/png", ".png"
+		} else {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+			rendition.ContentType, rendition.Ext = "image/jpeg", ".jpg"
+		}
+		if err != nil {
+			return nil, err
+		}
+		rendition.Data = buf.Bytes()
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+// resize scales src to fit into maxSide x maxSide, never upscaling.
+func resize(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return src
+	}
+	if width >= height {
+		height = height * maxSide / width
+		width = maxSide
+	} else {
+		width = width * maxSide / height
+		height = maxSide
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,51 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRenderRefusesDecompressionBomb(t *testing.T) {
+	data := encodePNG(t, 1, 1)
+	// Declare 60000x60000 in the IHDR chunk, which follows the 8 byte signature, its
+	// length and its type, and fix its CRC.
+	binary.BigEndian.PutUint32(data[16:], 60000)
+	binary.BigEndian.PutUint32(data[20:], 60000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := Render(data, "image/png"); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("Render() error = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestRenderResizes(t *testing.T) {
+	data := encodePNG(t, 2000, 500)
+	renditions, err := Render(data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][2]int{}
+	for _, r := range renditions {
+		got[r.Size.Name] = [2]int{r.Width, r.Height}
+	}
+	want := map[string][2]int{"original": {2000, 500}, "medium": {1024, 256}, "thumb": {256, 64}}
+	for name, size := range want {
+		if got[name] != size {
+			t.Errorf("%s is %v, want %v", name, got[name], size)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "taskservice"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	datastoreDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "datastore_call_duration_seconds",
+		Help:      "Latency of Redis and Elasticsearch calls by store and operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"store", "operation"})
+	datastoreErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "datastore_call_errors_total",
+		Help:      "Failed Redis and Elasticsearch calls by store and operation.",
+	}, []string{"store", "operation"})
+
+	postsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+	votesCast = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "votes_cast_total",
+		Help:      "Votes cast by the resulting vote: up, down or none when retracted.",
+	}, []string{"vote"})
+	searchesWithoutHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searches_zero_hits_total",
+		Help:      "Searches whose first page had no hits.",
+	})
+)
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveDatastore records the latency of a call to store, e.g. "redis", and counts it
+// as failed when err is not nil.
+func ObserveDatastore(store, operation string, start time.Time, err error) {
+	datastoreDuration.WithLabelValues(store, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		datastoreErrors.WithLabelValues(store, operation).Inc()
+	}
+}
+
+func PostCreated() {
+	postsCreated.Inc()
+}
+
+// VoteCast counts a vote by its resulting value: 1, -1, or 0 when retracted.
+func VoteCast(value int) {
+	vote := "none"
+	if value > 0 {
+		vote = "up"
+	} else if value < 0 {
+		vote = "down"
+	}
+	votesCast.WithLabelValues(vote).Inc()
+}
+
+func SearchWithoutHits() {
+	searchesWithoutHits.Inc()
+}
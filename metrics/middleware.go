@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"TaskService/response"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware counts requests and observes their latency, labeled by the mux route
+// template rather than the path, so that ids don't multiply the series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := response.Wrap(w)
+		next.ServeHTTP(rw, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		requests.WithLabelValues(route, r.Method, strconv.Itoa(rw.Status)).Inc()
+		requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
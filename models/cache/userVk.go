@@ -7,8 +7,9 @@ import (
 )
 
 type UserVk struct {
-	Token *oauth2.Token `json:"token"`
-	Info  *UserInfo     `json:"info"`
+	Token     *oauth2.Token `json:"token"`
+	Info      *UserInfo     `json:"info"`
+	CreatedAt time.Time     `json:"createdAt"`
 }
 
 func (u UserVk) MarshalBinary() (data []byte, err error) {
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type Checklist struct {
+	Id          string    `json:"id" db:"id"`
+	Title       string    `json:"title" db:"title"`
+	Description *string   `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"createdAt" db:"createdAt"`
+
+	Items []ChecklistItem `json:"items,omitempty" db:"-"`
+}
+
+type ChecklistItem struct {
+	Id          string     `json:"id" db:"id"`
+	ChecklistId string     `json:"checklistId" db:"checklistId"`
+	Title       string     `json:"title" db:"title"`
+	PostId      *string    `json:"postId" db:"postId"`
+	Deadline    *time.Time `json:"deadline" db:"deadline"`
+	Position    int        `json:"position" db:"position"`
+
+	// Done and CompletedAt are the caller's own state, set for authenticated requests.
+	Done        *bool      `json:"done,omitempty" db:"-"`
+	CompletedAt *time.Time `json:"completedAt,omitempty" db:"-"`
+}
+
+type ChecklistProgress struct {
+	ChecklistId string          `json:"checklistId"`
+	Total       int             `json:"total"`
+	Completed   int             `json:"completed"`
+	Percent     float64         `json:"percent"`
+	Items       []ChecklistItem `json:"items"`
+}
+
+type ChecklistDTO struct {
+	Title       string `json:"title" validate:"required,max=200"`
+	Description string `json:"description,omitempty" validate:"max=2000"`
+}
+
+type ChecklistItemDTO struct {
+	Title    string     `json:"title" validate:"required,max=200"`
+	PostId   *string    `json:"postId,omitempty" validate:"uuid"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Position orders items within a checklist; new items go last when it is omitted.
+	Position *int `json:"position,omitempty" validate:"min=0"`
+}
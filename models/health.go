@@ -0,0 +1,23 @@
+package models
+
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+type DependencyHealth struct {
+	Status    string  `json:"status"`
+	Hard      bool    `json:"hard"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Readiness is ready unless a hard dependency is down. Soft dependencies are reported
+// but don't take the instance out of rotation.
+type Readiness struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Media struct {
+	Id          string    `json:"id" db:"id"`
+	ContentType string    `json:"contentType" db:"contentType"`
+	Width       int       `json:"width" db:"width"`
+	Height      int       `json:"height" db:"height"`
+	Size        int64     `json:"size" db:"size"`
+	UploadedBy  int64     `json:"uploadedBy" db:"uploadedBy"`
+	CreatedAt   time.Time `json:"createdAt" db:"createdAt"`
+	// Keys maps rendition names ("original", "medium", "thumb") to store keys.
+	Keys map[string]string `json:"-" db:"keys"`
+
+	Urls map[string]string `json:"urls" db:"-"`
+}
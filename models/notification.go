@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	NotificationPostUpdated  = "post_updated"
+	NotificationPostDeleted  = "post_deleted"
+	NotificationVoteApproved = "vote_approved"
+	NotificationVoteVoided   = "vote_voided"
+)
+
+type Notification struct {
+	Id        int64      `json:"id" db:"id"`
+	UserId    int64      `json:"userId" db:"userId"`
+	Type      string     `json:"type" db:"type"`
+	PostId    *string    `json:"postId" db:"postId"`
+	Text      string     `json:"text" db:"text"`
+	ReadAt    *time.Time `json:"readAt" db:"readAt"`
+	CreatedAt time.Time  `json:"createdAt" db:"createdAt"`
+}
@@ -1,21 +1,59 @@
 package models
 
+import "time"
+
 type Post struct {
 	Id      string  `json:"id"`
 	Title   string  `json:"title"`
 	Content *string `json:"content"`
-	Rating  int     `json:"rating"`
-	Img     *string `json:"img"`
+	// ContentHtml is Content, a Markdown source, rendered to sanitized HTML.
+	ContentHtml *string   `json:"contentHtml" db:"contentHtml"`
+	Rating      int       `json:"rating"`
+	Img         *string   `json:"img"`
+	Upvotes     int       `json:"upvotes"`
+	Downvotes   int       `json:"downvotes"`
+	CreatedAt   time.Time `json:"createdAt" db:"createdAt"`
+	MediaId     *string   `json:"mediaId" db:"mediaId"`
+
+	// Lang is the language title and content are in.
+	Lang string `json:"lang,omitempty" db:"-"`
+	// Media maps rendition names of the post image to their URLs.
+	Media        map[string]string `json:"media,omitempty" db:"-"`
+	IsBookmarked *bool             `json:"isBookmarked,omitempty" db:"-"`
+	MyVote       *int              `json:"myVote,omitempty" db:"-"`
 }
 
 type PostAddDTO struct {
-	Title   string `json:"title"`
-	Content string `json:"content,omitempty"`
-	Img     string `json:"image,omitempty"`
+	Title   string `json:"title" validate:"required,max=200"`
+	Content string `json:"content,omitempty" validate:"max=20000"`
+	Img     string `json:"image,omitempty" validate:"max=2048,url=http|https"`
+	MediaId string `json:"mediaId,omitempty" validate:"uuid"`
+}
+
+// PostUpdateDTO replaces the text and image of a post. Rating and votes are not part of
+// it: they only change by voting.
+type PostUpdateDTO struct {
+	Id      string  `json:"id" validate:"required,uuid"`
+	Title   string  `json:"title" validate:"required,max=200"`
+	Content *string `json:"content" validate:"max=20000"`
+	Img     *string `json:"img" validate:"max=2048,url=http|https"`
+	MediaId *string `json:"mediaId" validate:"uuid"`
 }
 
 type PostES struct {
 	Id      string `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	*PostScoresES
+}
+
+// PostScoresES holds the ranking inputs of a post document; it is indexed
+// separately from the text so votes don't rewrite title and content.
+type PostScoresES struct {
+	Rating    int       `json:"rating"`
+	Upvotes   int       `json:"upvotes"`
+	Downvotes int       `json:"downvotes"`
+	Wilson    float64   `json:"wilson"`
+	Hot       float64   `json:"hot"`
+	CreatedAt time.Time `json:"createdAt"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type PostTranslation struct {
+	PostId      string    `json:"postId" db:"postId"`
+	Lang        string    `json:"lang" db:"lang"`
+	Title       string    `json:"title" db:"title"`
+	Content     *string   `json:"content" db:"content"`
+	ContentHtml *string   `json:"contentHtml" db:"contentHtml"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updatedAt"`
+}
+
+type PostTranslationDTO struct {
+	Title   string `json:"title" validate:"required,max=200"`
+	Content string `json:"content,omitempty" validate:"max=20000"`
+}
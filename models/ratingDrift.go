@@ -0,0 +1,8 @@
+package models
+
+// RatingDrift is a post whose stored rating did not match its votes.
+type RatingDrift struct {
+	PostId string `json:"postId" db:"postId"`
+	Old    int    `json:"old" db:"old"`
+	New    int    `json:"new" db:"new"`
+}
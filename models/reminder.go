@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	ReminderPending   = "pending"
+	ReminderSent      = "sent"
+	ReminderFailed    = "failed"
+	ReminderCancelled = "cancelled"
+)
+
+// ReminderPreference opts a user in to reminders DaysBefore days before checklist item deadlines,
+// only in the checklists they have ticked an item of when StartedOnly is set.
+type ReminderPreference struct {
+	UserId      int64     `json:"userId" db:"userId"`
+	DaysBefore  int       `json:"daysBefore" db:"daysBefore"`
+	StartedOnly bool      `json:"startedOnly" db:"startedOnly"`
+	CreatedAt   time.Time `json:"createdAt" db:"createdAt"`
+}
+
+// Reminder is one queued reminder about a checklist item deadline.
+type Reminder struct {
+	Id             string     `json:"id" db:"id"`
+	UserId         int64      `json:"userId" db:"userId"`
+	ItemId         string     `json:"itemId" db:"itemId"`
+	ItemTitle      string     `json:"itemTitle" db:"itemTitle"`
+	ChecklistId    string     `json:"checklistId" db:"checklistId"`
+	ChecklistTitle string     `json:"checklistTitle" db:"checklistTitle"`
+	Deadline       time.Time  `json:"deadline" db:"deadline"`
+	Status         string     `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	LastError      *string    `json:"lastError,omitempty" db:"lastError"`
+	SentAt         *time.Time `json:"sentAt,omitempty" db:"sentAt"`
+	CreatedAt      time.Time  `json:"createdAt" db:"createdAt"`
+}
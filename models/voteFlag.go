@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	VoteFlagPending  = "pending"
+	VoteFlagApproved = "approved"
+	VoteFlagVoided   = "voided"
+)
+
+// VoteFlag is a vote quarantined by the anomaly detector, waiting for a moderator.
+type VoteFlag struct {
+	Id         int64      `json:"id" db:"id"`
+	UserId     int64      `json:"userId" db:"userId"`
+	PostId     string     `json:"postId" db:"postId"`
+	Value      int        `json:"value" db:"value"`
+	Reason     string     `json:"reason" db:"reason"`
+	Status     string     `json:"status" db:"status"`
+	CreatedAt  time.Time  `json:"createdAt" db:"createdAt"`
+	ReviewedBy *int64     `json:"reviewedBy" db:"reviewedBy"`
+	ReviewedAt *time.Time `json:"reviewedAt" db:"reviewedAt"`
+}
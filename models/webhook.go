@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventPostCreated = "post.created"
+	EventPostUpdated = "post.updated"
+	EventPostDeleted = "post.deleted"
+)
+
+var WebhookEvents = []string{EventPostCreated, EventPostUpdated, EventPostDeleted}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription of an external service to post events. An empty Events
+// subscribes to all of them.
+type Webhook struct {
+	Id     string   `json:"id" db:"id"`
+	Url    string   `json:"url" db:"url"`
+	Events []string `json:"events" db:"events"`
+	// Secret signs the deliveries. It's only shown when the webhook is created.
+	Secret    string    `json:"secret,omitempty" db:"secret"`
+	Active    bool      `json:"active" db:"active"`
+	CreatedAt time.Time `json:"createdAt" db:"createdAt"`
+}
+
+type WebhookDTO struct {
+	Url    string   `json:"url" validate:"required,max=2048,url=http|https"`
+	Events []string `json:"events" validate:"oneof=post.created|post.updated|post.deleted"`
+	// Secret is generated when it's empty on creation and kept when it's empty on update.
+	Secret string `json:"secret,omitempty" validate:"max=256"`
+	Active *bool  `json:"active,omitempty"`
+}
+
+// WebhookDelivery is one event sent to one webhook, with the outcome of its last attempt.
+type WebhookDelivery struct {
+	Id           int64           `json:"id" db:"id"`
+	WebhookId    string          `json:"webhookId" db:"webhookId"`
+	Event        string          `json:"event" db:"event"`
+	Payload      json.RawMessage `json:"payload" db:"payload"`
+	Status       string          `json:"status" db:"status"`
+	Attempts     int             `json:"attempts" db:"attempts"`
+	ResponseCode *int            `json:"responseCode" db:"responseCode"`
+	LastError    *string         `json:"lastError" db:"lastError"`
+	CreatedAt    time.Time       `json:"createdAt" db:"createdAt"`
+	DeliveredAt  *time.Time      `json:"deliveredAt" db:"deliveredAt"`
+
+	// Url and Secret are the target of a claimed delivery.
+	Url    string `json:"-" db:"url"`
+	Secret string `json:"-" db:"secret"`
+}
+
+// PostEvent is the payload of post webhooks. Post is the post after the change,
+// only its id for deletions.
+type PostEvent struct {
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Post       interface{} `json:"post"`
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"TaskService/db"
+	"TaskService/models"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+const (
+	notificationsChannel = "notifications"
+	subscriberBuffer     = 16
+)
+
+// Broker delivers new notifications to every open stream of their user, on any
+// instance, by relaying them through Redis.
+type Broker struct {
+	logger *slog.Logger
+	redis  *db.RedisDb
+	mu     sync.Mutex
+	subs   map[int64]map[chan models.Notification]struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewBroker(logger *slog.Logger, redis *db.RedisDb) *Broker {
+	return &Broker{
+		logger: logger,
+		redis:  redis,
+		subs:   make(map[int64]map[chan models.Notification]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, notifications ...models.Notification) error {
+	for _, notification := range notifications {
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+		if err := b.redis.Publish(ctx, notificationsChannel, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the user's live notifications and the function ending the subscription.
+// Notifications are dropped for subscribers that fall behind; they stay in the
+// notification list. The channel is closed when the broker stops.
+func (b *Broker) Subscribe(userId int64) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[userId] == nil {
+		b.subs[userId] = make(map[chan models.Notification]struct{})
+	}
+	b.subs[userId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[userId][ch]; !ok {
+				return
+			}
+			delete(b.subs[userId], ch)
+			if len(b.subs[userId]) == 0 {
+				delete(b.subs, userId)
+			}
+			close(ch)
+		})
+	}
+}
+
+func (b *Broker) dispatch(notification models.Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[notification.UserId] {
+		select {
+		case ch <- notification:
+		default:
+			b.logger.Info("dropping notification for slow subscriber", "user", notification.UserId, "notification", notification.Id)
+		}
+	}
+}
+
+// Start delivers the notifications published by every instance until Stop is called.
+func (b *Broker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	go func() {
+		defer close(b.done)
+		b.redis.Listen(ctx, b.logger, notificationsChannel, func(payload string) {
+			var notification models.Notification
+			if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+				b.logger.Warn("error decoding notification", "err", err)
+				return
+			}
+			b.dispatch(notification)
+		})
+	}()
+}
+
+// Stop stops listening and closes every subscriber channel.
+func (b *Broker) Stop() {
+	b.cancel()
+	<-b.done
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for userId, chans := range b.subs {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(b.subs, userId)
+	}
+}
@@ -0,0 +1,19 @@
+package notify
+
+import "context"
+
+// Message is a notification for one VK user.
+type Message struct {
+	// Key identifies the notification. Resending a message with the same key must not
+	// notify the user twice where the channel supports it.
+	Key    string
+	UserId int64
+	Text   string
+}
+
+// Channel delivers messages to users. Send returns an error when the message may not
+// have been delivered, so the caller can retry it.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
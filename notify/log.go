@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// LogChannel writes messages to the log instead of delivering them. It keeps the sent
+// messages, skipping keys it has already seen, so it also serves as a fake in development.
+type LogChannel struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+	sent   []Message
+	seen   map[string]bool
+}
+
+func NewLogChannel(logger *slog.Logger) *LogChannel {
+	return &LogChannel{
+		logger: logger,
+		seen:   make(map[string]bool),
+	}
+}
+
+func (c *LogChannel) Name() string {
+	return "log"
+}
+
+func (c *LogChannel) Send(_ context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[msg.Key] {
+		c.logger.Info("skipping duplicate notification", "key", msg.Key)
+		return nil
+	}
+	c.seen[msg.Key] = true
+	c.sent = append(c.sent, msg)
+	c.logger.Info("notification", "user", msg.UserId, "text", msg.Text)
+	return nil
+}
+
+// Sent returns the messages delivered so far.
+func (c *LogChannel) Sent() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.sent...)
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"TaskService/models"
+	"TaskService/storages"
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Notifier saves notifications about domain events and publishes them to open streams.
+type Notifier struct {
+	logger           *slog.Logger
+	notificationStor *storages.NotificationStorage
+	broker           *Broker
+}
+
+func NewNotifier(logger *slog.Logger, notificationStor *storages.NotificationStorage, broker *Broker) *Notifier {
+	return &Notifier{
+		logger:           logger,
+		notificationStor: notificationStor,
+		broker:           broker,
+	}
+}
+
+// PostUpdated notifies the users who bookmarked the post that it was updated.
+func (n *Notifier) PostUpdated(ctx context.Context, post *models.Post, actorId int64) error {
+	text := fmt.Sprintf("Post \"%s\" you bookmarked was updated", post.Title)
+	notifications, err := n.notificationStor.CreateForBookmarkers(ctx, post.Id, models.NotificationPostUpdated, text, actorId)
+	if err != nil {
+		return err
+	}
+	return n.broker.Publish(ctx, notifications...)
+}
+
+// PostDeleted notifies bookmarkers, the users who bookmarked the post before it was
+// deleted, since the deletion removes the bookmarks. The notifications have no post.
+func (n *Notifier) PostDeleted(ctx context.Context, post *models.Post, bookmarkers []int64, actorId int64) error {
+	text := fmt.Sprintf("Post \"%s\" you bookmarked was deleted", post.Title)
+	notifications, err := n.notificationStor.CreateForUsers(ctx, bookmarkers, models.NotificationPostDeleted, nil, text, actorId)
+	if err != nil {
+		return err
+	}
+	return n.broker.Publish(ctx, notifications...)
+}
+
+// VoteReviewed notifies the voter of a moderator's decision on their quarantined vote.
+func (n *Notifier) VoteReviewed(ctx context.Context, flag *models.VoteFlag) error {
+	kind, text := models.NotificationVoteApproved, "Your vote was approved by a moderator and now counts"
+	if flag.Status == models.VoteFlagVoided {
+		kind, text = models.NotificationVoteVoided, "Your vote was voided by a moderator"
+	}
+	notification, err := n.notificationStor.Create(ctx, flag.UserId, kind, &flag.PostId, text)
+	if err != nil {
+		return err
+	}
+	return n.broker.Publish(ctx, *notification)
+}
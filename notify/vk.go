@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"github.com/go-vk-api/vk"
+	"hash/fnv"
+)
+
+// VkChannel sends messages on behalf of a VK community, which users must have allowed
+// to message them.
+type VkChannel struct {
+	client *vk.Client
+}
+
+func NewVkChannel(groupToken string) (*VkChannel, error) {
+	client, err := vk.NewClientWithOptions(vk.WithToken(groupToken))
+	if err != nil {
+		return nil, err
+	}
+	return &VkChannel{client: client}, nil
+}
+
+func (c *VkChannel) Name() string {
+	return "vk"
+}
+
+// Send derives random_id from the message key, so VK drops a resent duplicate itself.
+func (c *VkChannel) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var messageId int64
+	return c.client.CallMethod("messages.send", vk.RequestParams{
+		"user_id":   msg.UserId,
+		"random_id": randomId(msg.Key),
+		"message":   msg.Text,
+	}, &messageId)
+}
+
+func randomId(key string) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int32(h.Sum32() & 0x7fffffff)
+}
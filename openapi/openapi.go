@@ -0,0 +1,286 @@
+package openapi
+
+import (
+	"TaskService/controllers"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// spec is the OpenAPI 3 document of the public API. It is written by hand next to the
+// controllers, and the tests run Check to keep it honest.
+//
+//go:embed openapi.json
+var spec []byte
+
+// docs is a self-contained page rendering the spec, so the docs work offline.
+//
+//go:embed docs.html
+var docs []byte
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Register serves the spec at /openapi.json and a page browsing it at /docs.
+func Register(router *mux.Router) {
+	router.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	}).Methods("GET")
+	router.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(docs)
+	}).Methods("GET")
+}
+
+// RegisterDocumented registers the routes that the spec describes. The tests register
+// them the same way to check the spec against them.
+func RegisterDocumented(router *mux.Router, pc *controllers.PostController, ac *controllers.AccountController) {
+	pc.Register("/post", router)
+	ac.Register("/acc", router)
+}
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]schema   `json:"schemas"`
+		Responses map[string]response `json:"responses"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationId string              `json:"operationId"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type response struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+// Check compares the spec with router, which has exactly the documented routes
+// registered, and with schemas, which maps component schema names to the Go values
+// they describe. It returns every mismatch, so an empty result means the spec covers
+// each route with its responses and matches the json fields of each type:
+//
+//   - every route and method is documented, and every documented operation is routed;
+//   - every operation has an operationId, a success response and a default one;
+//   - every response body has a schema, and error bodies are problem+json;
+//   - every $ref resolves;
+//   - the properties of each schema are the json fields of its type, and fields
+//     validated as required are required.
+func Check(router *mux.Router, schemas map[string]any) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return []string{"invalid spec: " + err.Error()}
+	}
+	var tree any
+	_ = json.Unmarshal(spec, &tree)
+	for _, ref := range collectRefs(tree) {
+		if !resolves(tree, ref) {
+			add("unresolved $ref %s", ref)
+		}
+	}
+
+	routed := checkRoutes(router, doc, add)
+	checkOperations(doc, routed, add)
+	checkSchemas(doc, schemas, add)
+
+	sort.Strings(problems)
+	return problems
+}
+
+// checkRoutes reports routes missing from the spec and returns the documented
+// operations that are routed, as "METHOD path". A route without methods accepts any,
+// so one operation on its path is enough.
+func checkRoutes(router *mux.Router, doc document, add func(string, ...any)) map[string]bool {
+	routed := map[string]bool{}
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		item, ok := doc.Paths[path]
+		if !ok {
+			add("%s: path not documented", path)
+			return nil
+		}
+		routeMethods, err := route.GetMethods()
+		if err != nil {
+			documented := false
+			for _, method := range methods {
+				if _, ok := item[method]; ok {
+					routed[strings.ToUpper(method)+" "+path] = true
+					documented = true
+				}
+			}
+			if !documented {
+				add("%s: no operation documented", path)
+			}
+			return nil
+		}
+		for _, method := range routeMethods {
+			if _, ok := item[strings.ToLower(method)]; !ok {
+				add("%s %s: operation not documented", method, path)
+				continue
+			}
+			routed[method+" "+path] = true
+		}
+		return nil
+	})
+	return routed
+}
+
+func checkOperations(doc document, routed map[string]bool, add func(string, ...any)) {
+	operationIds := map[string]string{}
+	for path, item := range doc.Paths {
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			name := strings.ToUpper(method) + " " + path
+			if !routed[name] {
+				add("%s: documented but not routed", name)
+			}
+
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				add("%s: invalid operation: %v", name, err)
+				continue
+			}
+			if op.OperationId == "" {
+				add("%s: no operationId", name)
+			} else if other, ok := operationIds[op.OperationId]; ok {
+				add("%s: operationId %s is taken by %s", name, op.OperationId, other)
+			} else {
+				operationIds[op.OperationId] = name
+			}
+
+			success := false
+			for status, resp := range op.Responses {
+				success = success || status[0] == '2' || status[0] == '3'
+				if resp.Ref != "" {
+					resp = doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+				}
+				isError := status == "default" || status[0] == '4' || status[0] == '5'
+				for mediaType, content := range resp.Content {
+					if len(content.Schema) == 0 {
+						add("%s: %s %s response has no schema", name, status, mediaType)
+					}
+					if isError && mediaType != "application/problem+json" {
+						add("%s: %s response is %s, not application/problem+json", name, status, mediaType)
+					}
+				}
+				if isError && len(resp.Content) == 0 {
+					add("%s: %s response has no problem body", name, status)
+				}
+			}
+			if !success {
+				add("%s: no success response", name)
+			}
+			if _, ok := op.Responses["default"]; !ok {
+				add("%s: no default response", name)
+			}
+		}
+	}
+}
+
+func checkSchemas(doc document, schemas map[string]any, add func(string, ...any)) {
+	for name, value := range schemas {
+		s, ok := doc.Components.Schemas[name]
+		if !ok {
+			add("schema %s: not documented", name)
+			continue
+		}
+		required := map[string]bool{}
+		for _, field := range s.Required {
+			required[field] = true
+			if _, ok := s.Properties[field]; !ok {
+				add("schema %s: required %s is not a property", name, field)
+			}
+		}
+
+		t := reflect.TypeOf(value)
+		fields := map[string]bool{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || jsonName == "-" {
+				continue
+			}
+			if jsonName == "" {
+				jsonName = field.Name
+			}
+			fields[jsonName] = true
+			if _, ok := s.Properties[jsonName]; !ok {
+				add("schema %s: field %s of %s is not documented", name, jsonName, t)
+			}
+			rules := strings.Split(field.Tag.Get("validate"), ",")
+			if slices.Contains(rules, "required") && !required[jsonName] {
+				add("schema %s: %s is required by %s but not by the spec", name, jsonName, t)
+			}
+		}
+		for property := range s.Properties {
+			if !fields[property] {
+				add("schema %s: property %s is not a field of %s", name, property, t)
+			}
+		}
+	}
+}
+
+// collectRefs returns every $ref in the decoded JSON value.
+func collectRefs(value any) []string {
+	var refs []string
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				refs = append(refs, ref)
+				continue
+			}
+			refs = append(refs, collectRefs(item)...)
+		}
+	case []any:
+		for _, item := range v {
+			refs = append(refs, collectRefs(item)...)
+		}
+	}
+	return refs
+}
+
+// resolves tells whether ref, a local JSON pointer like #/components/schemas/Post,
+// points into the decoded document.
+func resolves(tree any, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	node := tree
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
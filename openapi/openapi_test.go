@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"TaskService/controllers"
+	"TaskService/models"
+	"TaskService/models/cache"
+	"TaskService/problem"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// schemas maps the component schemas to the Go types they describe.
+var schemas = map[string]any{
+	"Post":       models.Post{},
+	"PostAdd":    models.PostAddDTO{},
+	"PostUpdate": models.PostUpdateDTO{},
+	"Vote":       controllers.VoteDTO{},
+	"Session":    controllers.TokenDTO{},
+	"UserInfo":   cache.UserInfo{},
+	"Problem":    problem.Problem{},
+}
+
+// documentedRouter registers the documented routes. Registering only binds the
+// handlers, so controllers without dependencies will do.
+func documentedRouter() *mux.Router {
+	router := mux.NewRouter()
+	RegisterDocumented(router, &controllers.PostController{}, &controllers.AccountController{})
+	return router
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	if problems := Check(documentedRouter(), schemas); len(problems) > 0 {
+		for _, p := range problems {
+			t.Error(p)
+		}
+		t.Fatal("openapi.json doesn't match the routes")
+	}
+}
+
+func TestCheckReportsUndocumentedRoute(t *testing.T) {
+	router := documentedRouter()
+	router.HandleFunc("/post/{id}/undocumented", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	router.HandleFunc("/acc/login", func(http.ResponseWriter, *http.Request) {}).Methods("DELETE")
+
+	problems := Check(router, schemas)
+	for _, want := range []string{
+		"/post/{id}/undocumented: path not documented",
+		"DELETE /acc/login: operation not documented",
+	} {
+		if !slices.Contains(problems, want) {
+			t.Errorf("problems %q lack %q", problems, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Code identifies the kind of failure. Codes are part of the API: clients match on
+// them instead of on the detail text, so an existing code never changes its meaning.
+type Code string
+
+const (
+	Internal             Code = "internal_error"
+	Timeout              Code = "timeout"
+	Unavailable          Code = "service_unavailable"
+	InvalidBody          Code = "invalid_body"
+	ValidationFailed     Code = "validation_failed"
+	SessionRequired      Code = "session_required"
+	SessionExpired       Code = "session_expired"
+	Forbidden            Code = "forbidden"
+	RateLimited          Code = "rate_limited"
+	PayloadTooLarge      Code = "payload_too_large"
+	UnsupportedMediaType Code = "unsupported_media_type"
+	RouteNotFound        Code = "route_not_found"
+	MethodNotAllowed     Code = "method_not_allowed"
+
+	PostNotFound          Code = "post_not_found"
+	MediaNotFound         Code = "media_not_found"
+	TranslationNotFound   Code = "translation_not_found"
+	ChecklistNotFound     Code = "checklist_not_found"
+	ChecklistItemNotFound Code = "checklist_item_not_found"
+	ReminderPrefNotFound  Code = "reminder_preference_not_found"
+	FlagNotFound          Code = "flag_not_found"
+	WebhookNotFound       Code = "webhook_not_found"
+	DeliveryNotFound      Code = "delivery_not_found"
+
+	VoteDuplicate Code = "vote_duplicate"
+	VoteInvalid   Code = "vote_invalid"
+	FlagReviewed  Code = "flag_reviewed"
+)
+
+// ContentType is the media type of a problem response.
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem type URI.
+const typePrefix = "urn:taskservice:problem:"
+
+// Problem is an RFC 7807 problem detail with the code as an extension member.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   Code   `json:"code"`
+	// Errors maps each invalid field of a validation_failed request to what is wrong with it.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// New returns the problem of code with the status' text as the title. detail explains
+// this occurrence to a human and may be empty.
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return string(p.Code)
+	}
+	return string(p.Code) + ": " + p.Detail
+}
+
+// Write responds with the problem, replacing the content type set by middleware.
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Burst tokens at most, refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses "<requests>/<period>,<burst>", e.g. "30/1m,10".
+// The burst defaults to the number of requests.
+func ParseLimit(value string) (Limit, error) {
+	ratePart, burstPart, hasBurst := strings.Cut(value, ",")
+	requestsPart, periodPart, ok := strings.Cut(ratePart, "/")
+	if !ok {
+		return Limit{}, errors.New("rate limit must look like <requests>/<period>[,<burst>]")
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(requestsPart))
+	if err != nil || requests < 1 {
+		return Limit{}, errors.New("rate limit requests must be a positive integer")
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(periodPart))
+	if err != nil || period <= 0 {
+		return Limit{}, errors.New("rate limit period must be a positive duration")
+	}
+
+	burst := requests
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstPart))
+		if err != nil || burst < 1 {
+			return Limit{}, errors.New("rate limit burst must be a positive integer")
+		}
+	}
+
+	return Limit{Rate: float64(requests) / period.Seconds(), Burst: burst}, nil
+}
+
+// Result describes the bucket after taking a token.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Backend stores token buckets.
+type Backend interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult derives the result fields from the tokens left in a bucket.
+func newResult(allowed bool, tokens float64, limit Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+	return res
+}
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+// MemoryBackend keeps buckets in process memory. It only limits a single
+// instance and is meant for tests and local runs.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return NewMemoryBackendWithClock(time.Now)
+}
+
+// NewMemoryBackendWithClock lets tests drive refills with a fake clock.
+func NewMemoryBackendWithClock(now func() time.Time) *MemoryBackend {
+	return &MemoryBackend{
+		buckets: make(map[string]*bucket),
+		now:     now,
+	}
+}
+
+func (b *MemoryBackend) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(limit.Burst), ts: now}
+		b.buckets[key] = bk
+	}
+
+	elapsed := now.Sub(bk.ts).Seconds()
+	if elapsed > 0 {
+		bk.tokens = math.Min(float64(limit.Burst), bk.tokens+elapsed*limit.Rate)
+		bk.ts = now
+	}
+
+	allowed := bk.tokens >= 1
+	if allowed {
+		bk.tokens--
+	}
+
+	return newResult(allowed, bk.tokens, limit), nil
+}
@@ -0,0 +1,199 @@
+package ratelimit
+
+import (
+	"TaskService/logging"
+	"TaskService/models/cache"
+	"TaskService/problem"
+	"context"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultGroup = "default"
+
+// keyDelimiter separates the parts of bucket keys, like db.RedisDelimeter does for the
+// other Redis keys.
+const keyDelimiter = "::"
+
+// Group limits a set of routes, identified by mux path template and method.
+// Routes are written as "METHOD /path/{template}"; "/path" alone matches any method.
+type Group struct {
+	Name   string
+	Limit  Limit
+	Routes []string
+}
+
+// KeyFunc identifies the client a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+type Limiter struct {
+	backend  Backend
+	groups   []Group
+	fallback *Group
+	key      KeyFunc
+}
+
+// NewLimiter limits requests by group. The group named "default", if present,
+// applies to every route no other group matches.
+func NewLimiter(backend Backend, groups []Group, key KeyFunc) *Limiter {
+	l := &Limiter{
+		backend: backend,
+		key:     key,
+	}
+	for i := range groups {
+		if groups[i].Name == defaultGroup {
+			l.fallback = &groups[i]
+			continue
+		}
+		l.groups = append(l.groups, groups[i])
+	}
+	return l
+}
+
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := l.match(r)
+		if group == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ratelimit" + keyDelimiter + group.Name + keyDelimiter + l.key(r)
+		res, err := l.backend.Take(r.Context(), key, group.Limit)
+		if err != nil {
+			// Fail open: an unavailable limiter must not take the API down.
+			logging.FromContext(r.Context()).Error("error taking rate limit token", "key", key, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(group.Limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter.Seconds())))
+			logging.FromContext(r.Context()).Info("rate limit exceeded", "key", key)
+			problem.New(http.StatusTooManyRequests, problem.RateLimited, "Too many requests").Write(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) match(r *http.Request) *Group {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return l.fallback
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return l.fallback
+	}
+
+	for i, group := range l.groups {
+		for _, pattern := range group.Routes {
+			method, path, hasMethod := strings.Cut(pattern, " ")
+			if !hasMethod {
+				path, method = method, ""
+			}
+			if path == template && (method == "" || method == r.Method) {
+				return &l.groups[i]
+			}
+		}
+	}
+	return l.fallback
+}
+
+func ceilSeconds(seconds float64) int {
+	return int(math.Ceil(seconds))
+}
+
+// Sessions looks up session tokens, as storages.SessionStorage does.
+type Sessions interface {
+	GetSession(ctx context.Context, sessionToken string) (*cache.UserVk, error)
+}
+
+// SessionOrIPKey counts authenticated requests per VK user and the rest per client IP.
+// Only the header and query session token are checked, so request bodies stay unread.
+func SessionOrIPKey(sessionStor Sessions, trustedProxies []*net.IPNet) KeyFunc {
+	return func(r *http.Request) string {
+		token := r.Header.Get("X-Session-Token")
+		if token == "" {
+			token = r.URL.Query().Get("sessionToken")
+		}
+		if token != "" {
+			if userVk, err := sessionStor.GetSession(r.Context(), token); err == nil && userVk.Valid() {
+				return "user:" + strconv.FormatInt(userVk.Info.Id, 10)
+			}
+		}
+		return "ip:" + ClientIP(r, trustedProxies)
+	}
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is honored only
+// when the direct peer is a trusted proxy, walking the chain from the right
+// until the first address that isn't a trusted proxy.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+		if !isTrusted(ip, trustedProxies) {
+			return ip
+		}
+		remote = ip
+	}
+	return remote
+}
+
+func isTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of CIDRs or single addresses.
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
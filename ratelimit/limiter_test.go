@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"TaskService/problem"
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock the tests move by hand.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestMemoryBackendRefill(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	backend := NewMemoryBackendWithClock(clock.Now)
+	limit := Limit{Rate: 1, Burst: 2}
+	take := func() Result {
+		t.Helper()
+		res, err := backend.Take(context.Background(), "key", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := take(); !res.Allowed {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	res := take()
+	if res.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", res.RetryAfter)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if take().Allowed {
+		t.Fatal("half a token was enough")
+	}
+	clock.Advance(500 * time.Millisecond)
+	if !take().Allowed {
+		t.Fatal("no token after a second at 1/s")
+	}
+
+	// Refill stops at the burst.
+	clock.Advance(time.Hour)
+	if res := take(); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("after an hour got %+v, want allowed with 1 remaining", res)
+	}
+}
+
+func TestMiddlewareRefusesOverBurst(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter := NewLimiter(NewMemoryBackendWithClock(clock.Now), []Group{
+		{Name: "search", Limit: Limit{Rate: 0.5, Burst: 2}, Routes: []string{"GET /post/search"}},
+		{Name: defaultGroup, Limit: Limit{Rate: 10, Burst: 50}},
+	}, func(*http.Request) string { return "ip:192.0.2.1" })
+
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+	router.HandleFunc("/post/search", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	router.HandleFunc("/post", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve("/post/search"); w.Code != http.StatusOK {
+			t.Fatalf("request %d got %d", i+1, w.Code)
+		}
+	}
+	w := serve("/post/search")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst got %d, want 429", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":        problem.ContentType,
+		"Retry-After":         "2",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "4",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	// Other routes count against their own group.
+	if w := serve("/post"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "50" {
+		t.Errorf("default group got %d with limit %q", w.Code, w.Header().Get("RateLimit-Limit"))
+	}
+
+	clock.Advance(2 * time.Second)
+	if w := serve("/post/search"); w.Code != http.StatusOK {
+		t.Errorf("after Retry-After got %d", w.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer can't forward", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left entry", "10.0.0.1:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.0.0.1:4000", []string{"198.51.100.1, 192.0.2.10", "10.1.1.1"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.1:4000", []string{"10.2.2.2"}, "10.2.2.2"},
+		{"no header", "10.0.0.1:4000", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(r, proxies); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// takeScript refills and takes from the bucket atomically. It uses the Redis
+// clock, so instances with skewed clocks share the same buckets correctly.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+// Evaler runs Lua scripts on Redis, as db.RedisDb does. The package takes it rather than
+// the client, so config can import the package without the datastore drivers.
+type Evaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisBackend shares buckets between app instances through Redis.
+type RedisBackend struct {
+	redis Evaler
+}
+
+func NewRedisBackend(redis Evaler) *RedisBackend {
+	return &RedisBackend{redis: redis}
+}
+
+func (b *RedisBackend) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	reply, err := b.redis.Eval(ctx, takeScript, []string{key},
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64), limit.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, errors.New("unexpected rate limit script reply")
+	}
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(allowed == 1, tokens, limit), nil
+}
@@ -0,0 +1,117 @@
+package storages
+
+import (
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+type BookmarkStorage struct {
+	conn      *pgxpool.Pool
+	logger    *slog.Logger
+	tableName string
+}
+
+func NewBookmarkStorage(logger *slog.Logger, conn *pgxpool.Pool) *BookmarkStorage {
+	stor := &BookmarkStorage{
+		conn:      conn,
+		logger:    logger,
+		tableName: "public.\"Bookmarks\"",
+	}
+	stor.createTableIfNotExist()
+
+	return stor
+}
+
+func (s *BookmarkStorage) createTableIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n \"postId\" uuid NOT NULL,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"Bookmarks_pkey\" PRIMARY KEY (\"userId\", \"postId\"),"+
+		"\n CONSTRAINT \"Bookmarks_postId_fkey\" FOREIGN KEY (\"postId\")"+
+		"\n REFERENCES public.\"Posts\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Add bookmarks the post for the user. Bookmarking twice is not an error.
+func (s *BookmarkStorage) Add(ctx context.Context, userId int64, postId string) error {
+	_, err := s.conn.Exec(ctx, "INSERT INTO "+s.tableName+
+		" (\"userId\", \"postId\") VALUES ($1, $2)"+
+		"\n ON CONFLICT (\"userId\", \"postId\") DO NOTHING", userId, postId)
+	return err
+}
+
+// Remove deletes the bookmark. Removing a missing bookmark is not an error.
+func (s *BookmarkStorage) Remove(ctx context.Context, userId int64, postId string) error {
+	_, err := s.conn.Exec(ctx, "DELETE FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1 AND \"postId\"=$2", userId, postId)
+	return err
+}
+
+// GetUserIds returns the ids of the users who bookmarked the post.
+func (s *BookmarkStorage) GetUserIds(ctx context.Context, postId string) ([]int64, error) {
+	rows, err := s.conn.Query(ctx, "SELECT \"userId\" FROM "+s.tableName+
+		"\n WHERE \"postId\"=$1", postId)
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]int64, 0)
+	if err := pgxscan.ScanAll(&userIds, rows); err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+// GetPostIds returns a page of bookmarked post ids, newest first, and the total count.
+func (s *BookmarkStorage) GetPostIds(ctx context.Context, userId int64, size, page int) ([]string, int, error) {
+	var total int
+	if err := s.conn.QueryRow(ctx, "SELECT count(*) FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1", userId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT \"postId\"::text FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1"+
+		"\n ORDER BY \"createdAt\" DESC"+
+		"\n LIMIT $2 OFFSET $3", userId, size, size*(page-1))
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, 0)
+	if err := pgxscan.ScanAll(&ids, rows); err != nil {
+		return nil, 0, err
+	}
+
+	return ids, total, nil
+}
+
+// GetBookmarked returns the subset of postIds bookmarked by the user in a single query.
+func (s *BookmarkStorage) GetBookmarked(ctx context.Context, userId int64, postIds []string) (map[string]bool, error) {
+	bookmarked := make(map[string]bool, len(postIds))
+	if len(postIds) == 0 {
+		return bookmarked, nil
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT \"postId\"::text FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1 AND \"postId\" = ANY($2::uuid[])", userId, postIds)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := pgxscan.ScanAll(&ids, rows); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		bookmarked[id] = true
+	}
+
+	return bookmarked, nil
+}
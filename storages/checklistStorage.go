@@ -0,0 +1,284 @@
+package storages
+
+import (
+	"TaskService/models"
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"math"
+	"time"
+)
+
+type ChecklistStorage struct {
+	conn              *pgxpool.Pool
+	logger            *slog.Logger
+	tableName         string
+	itemsTableName    string
+	progressTableName string
+}
+
+func NewChecklistStorage(logger *slog.Logger, conn *pgxpool.Pool) *ChecklistStorage {
+	stor := &ChecklistStorage{
+		conn:              conn,
+		logger:            logger,
+		tableName:         "public.\"Checklists\"",
+		itemsTableName:    "public.\"ChecklistItems\"",
+		progressTableName: "public.\"ChecklistProgress\"",
+	}
+	stor.createTablesIfNotExist()
+
+	return stor
+}
+
+func (s *ChecklistStorage) createTablesIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n id uuid NOT NULL,"+
+		"\n title text NOT NULL,"+
+		"\n description text,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"Checklists_pkey\" PRIMARY KEY (id)"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.itemsTableName+
+		"\n ("+
+		"\n id uuid NOT NULL,"+
+		"\n \"checklistId\" uuid NOT NULL,"+
+		"\n title text NOT NULL,"+
+		"\n \"postId\" uuid,"+
+		"\n deadline timestamp with time zone,"+
+		"\n position integer NOT NULL DEFAULT 0,"+
+		"\n CONSTRAINT \"ChecklistItems_pkey\" PRIMARY KEY (id),"+
+		"\n CONSTRAINT \"ChecklistItems_checklistId_fkey\" FOREIGN KEY (\"checklistId\")"+
+		"\n REFERENCES "+s.tableName+" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE,"+
+		"\n CONSTRAINT \"ChecklistItems_postId_fkey\" FOREIGN KEY (\"postId\")"+
+		"\n REFERENCES public.\"Posts\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE SET NULL"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.progressTableName+
+		"\n ("+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n \"itemId\" uuid NOT NULL,"+
+		"\n \"completedAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"ChecklistProgress_pkey\" PRIMARY KEY (\"userId\", \"itemId\"),"+
+		"\n CONSTRAINT \"ChecklistProgress_itemId_fkey\" FOREIGN KEY (\"itemId\")"+
+		"\n REFERENCES "+s.itemsTableName+" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	checklistColumns     = "id::text AS id, title, description, \"createdAt\""
+	checklistItemColumns = "id::text AS id, \"checklistId\"::text AS \"checklistId\", title, \"postId\"::text AS \"postId\", deadline, position"
+)
+
+func (s *ChecklistStorage) GetAll(ctx context.Context) ([]models.Checklist, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+checklistColumns+
+		"\n FROM "+s.tableName+
+		"\n ORDER BY \"createdAt\"")
+	if err != nil {
+		return nil, err
+	}
+	checklists := make([]models.Checklist, 0)
+	if err := pgxscan.ScanAll(&checklists, rows); err != nil {
+		return nil, err
+	}
+	return checklists, nil
+}
+
+// GetOne returns the checklist with its items in order. pgx.ErrNoRows means it does not exist.
+func (s *ChecklistStorage) GetOne(ctx context.Context, id string) (*models.Checklist, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+checklistColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	var checklist models.Checklist
+	if err := pgxscan.ScanOne(&checklist, rows); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, err
+	}
+
+	checklist.Items, err = s.getItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &checklist, nil
+}
+
+func (s *ChecklistStorage) getItems(ctx context.Context, checklistId string) ([]models.ChecklistItem, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+checklistItemColumns+
+		"\n FROM "+s.itemsTableName+
+		"\n WHERE \"checklistId\"=$1"+
+		"\n ORDER BY position, title", checklistId)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]models.ChecklistItem, 0)
+	if err := pgxscan.ScanAll(&items, rows); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *ChecklistStorage) Create(ctx context.Context, checklist *models.ChecklistDTO) (string, error) {
+	id := uuid.New().String()
+	_, err := s.conn.Exec(ctx, "INSERT INTO "+s.tableName+
+		"\n (id, title, description) VALUES ($1, $2, $3)", id, checklist.Title, nullIfEmpty(checklist.Description))
+	return id, err
+}
+
+// Update changes the checklist and reports whether it exists.
+func (s *ChecklistStorage) Update(ctx context.Context, id string, checklist *models.ChecklistDTO) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "UPDATE "+s.tableName+
+		"\n SET title=$2, description=$3"+
+		"\n WHERE id=$1", id, checklist.Title, nullIfEmpty(checklist.Description))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Delete removes the checklist with its items and everyone's progress.
+func (s *ChecklistStorage) Delete(ctx context.Context, id string) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "DELETE FROM "+s.tableName+" WHERE id=$1", id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *ChecklistStorage) CreateItem(ctx context.Context, checklistId string, item *models.ChecklistItemDTO) (string, error) {
+	id := uuid.New().String()
+	_, err := s.conn.Exec(ctx, "INSERT INTO "+s.itemsTableName+
+		"\n (id, \"checklistId\", title, \"postId\", deadline, position)"+
+		"\n VALUES ($1, $2, $3, $4, $5,"+
+		"\n COALESCE($6, (SELECT COALESCE(MAX(position), -1) + 1 FROM "+s.itemsTableName+" WHERE \"checklistId\"=$2)))",
+		id, checklistId, item.Title, item.PostId, item.Deadline, item.Position)
+	return id, err
+}
+
+// UpdateItem changes an item of the checklist and reports whether it exists.
+func (s *ChecklistStorage) UpdateItem(ctx context.Context, checklistId, itemId string, item *models.ChecklistItemDTO) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "UPDATE "+s.itemsTableName+
+		"\n SET title=$3, \"postId\"=$4, deadline=$5, position=COALESCE($6, position)"+
+		"\n WHERE id=$1 AND \"checklistId\"=$2", itemId, checklistId, item.Title, item.PostId, item.Deadline, item.Position)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *ChecklistStorage) DeleteItem(ctx context.Context, checklistId, itemId string) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "DELETE FROM "+s.itemsTableName+
+		"\n WHERE id=$1 AND \"checklistId\"=$2", itemId, checklistId)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetItemDone ticks an item off for the user or unticks it, and reports whether the item exists.
+func (s *ChecklistStorage) SetItemDone(ctx context.Context, userId int64, checklistId, itemId string, done bool) (bool, error) {
+	var exists bool
+	if err := s.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+s.itemsTableName+
+		"\n WHERE id=$1 AND \"checklistId\"=$2)", itemId, checklistId).Scan(&exists); err != nil || !exists {
+		return false, err
+	}
+
+	var err error
+	if done {
+		_, err = s.conn.Exec(ctx, "INSERT INTO "+s.progressTableName+
+			"\n (\"userId\", \"itemId\") VALUES ($1, $2)"+
+			"\n ON CONFLICT (\"userId\", \"itemId\") DO NOTHING", userId, itemId)
+	} else {
+		_, err = s.conn.Exec(ctx, "DELETE FROM "+s.progressTableName+
+			"\n WHERE \"userId\"=$1 AND \"itemId\"=$2", userId, itemId)
+	}
+	return true, err
+}
+
+// FillDone sets the user's completion state on items with one query.
+func (s *ChecklistStorage) FillDone(ctx context.Context, userId int64, items []models.ChecklistItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT \"itemId\"::text, \"completedAt\""+
+		"\n FROM "+s.progressTableName+
+		"\n WHERE \"userId\"=$1 AND \"itemId\" = ANY($2::uuid[])", userId, ids)
+	if err != nil {
+		return err
+	}
+	completed := make(map[string]time.Time, len(items))
+	for rows.Next() {
+		var itemId string
+		var completedAt time.Time
+		if err := rows.Scan(&itemId, &completedAt); err != nil {
+			return err
+		}
+		completed[itemId] = completedAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range items {
+		completedAt, done := completed[items[i].Id]
+		items[i].Done = &done
+		if done {
+			items[i].CompletedAt = &completedAt
+		}
+	}
+	return nil
+}
+
+// GetProgress returns the user's completion of the checklist. pgx.ErrNoRows means it does not exist.
+func (s *ChecklistStorage) GetProgress(ctx context.Context, userId int64, checklistId string) (*models.ChecklistProgress, error) {
+	checklist, err := s.GetOne(ctx, checklistId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.FillDone(ctx, userId, checklist.Items); err != nil {
+		return nil, err
+	}
+
+	progress := &models.ChecklistProgress{
+		ChecklistId: checklistId,
+		Total:       len(checklist.Items),
+		Items:       checklist.Items,
+	}
+	for _, item := range checklist.Items {
+		if *item.Done {
+			progress.Completed++
+		}
+	}
+	if progress.Total > 0 {
+		progress.Percent = math.Round(float64(progress.Completed)*1000/float64(progress.Total)) / 10
+	}
+	return progress, nil
+}
@@ -1,43 +1,45 @@
 package storages
 
-type DoubleOperError struct {
-	msg  string
-	Data any
-	oper rune
-}
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"net"
+)
 
-func (e DoubleOperError) Error() string {
-	return e.msg + string(e.oper)
-}
+// pgQueryCanceled is the code of a statement cancelled by statement_timeout.
+const pgQueryCanceled = "57014"
 
-func NewDoubleOperError(oper rune, msg *string, data any) DoubleOperError {
-	defaultMsg := "double oper "
-	if msg == nil {
-		msg = &defaultMsg
+// IsTimeout reports whether err comes from a datastore call that ran out of time,
+// either by the request deadline or by the datastore's own timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
 	}
-	return DoubleOperError{
-		msg:  *msg,
-		oper: oper,
-		Data: data,
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled {
+		return true
 	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
-type InvalidOperError struct {
-	msg  string
-	oper rune
+// DoubleOperError is a vote repeating the user's current one, e.g. '+' after '+'.
+type DoubleOperError struct {
+	Oper rune
+	// Vote is the user's current vote, which stays as is.
+	Vote int
 }
 
-func (e InvalidOperError) Error() string {
-	return e.msg + " " + string(e.oper)
+func (e *DoubleOperError) Error() string {
+	return "double oper " + string(e.Oper)
 }
 
-func NewInvalidOperError(oper rune, msg *string) InvalidOperError {
-	err := InvalidOperError{
-		oper: oper,
-		msg:  "invalid operation",
-	}
-	if msg == nil {
-		err.msg = *msg
-	}
-	return err
+// InvalidOperError is an oper other than '+' and '-'.
+type InvalidOperError struct {
+	Oper rune
+}
+
+func (e *InvalidOperError) Error() string {
+	return "invalid operation " + string(e.Oper)
 }
@@ -0,0 +1,147 @@
+package storages
+
+import (
+	"TaskService/logging"
+	"TaskService/media"
+	"TaskService/models"
+	"bytes"
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+type MediaStorage struct {
+	conn      *pgxpool.Pool
+	logger    *slog.Logger
+	tableName string
+	store     media.Store
+}
+
+func NewMediaStorage(logger *slog.Logger, conn *pgxpool.Pool, store media.Store) *MediaStorage {
+	stor := &MediaStorage{
+		conn:      conn,
+		logger:    logger,
+		tableName: "public.\"Media\"",
+		store:     store,
+	}
+	stor.createTableIfNotExist()
+
+	return stor
+}
+
+func (s *MediaStorage) createTableIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n id uuid NOT NULL,"+
+		"\n \"contentType\" text NOT NULL,"+
+		"\n width integer NOT NULL,"+
+		"\n height integer NOT NULL,"+
+		"\n size bigint NOT NULL,"+
+		"\n \"uploadedBy\" bigint NOT NULL,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n keys jsonb NOT NULL,"+
+		"\n CONSTRAINT \"Media_pkey\" PRIMARY KEY (id)"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Create stores every rendition and then the metadata row. Objects already written
+// are removed again when a later step fails.
+func (s *MediaStorage) Create(ctx context.Context, item *models.Media, renditions []media.Rendition) error {
+	item.Keys = make(map[string]string, len(renditions))
+	for _, rendition := range renditions {
+		key := item.Id + "/" + rendition.Size.Name + rendition.Ext
+		if err := s.store.Put(ctx, key, rendition.ContentType, bytes.NewReader(rendition.Data), int64(len(rendition.Data))); err != nil {
+			s.deleteObjects(ctx, item.Keys)
+			return err
+		}
+		item.Keys[rendition.Size.Name] = key
+	}
+
+	err := s.conn.QueryRow(ctx, "INSERT INTO "+s.tableName+
+		"\n (id, \"contentType\", width, height, size, \"uploadedBy\", keys)"+
+		"\n VALUES ($1, $2, $3, $4, $5, $6, $7)"+
+		"\n RETURNING \"createdAt\"",
+		item.Id, item.ContentType, item.Width, item.Height, item.Size, item.UploadedBy, item.Keys).Scan(&item.CreatedAt)
+	if err != nil {
+		s.deleteObjects(ctx, item.Keys)
+		return err
+	}
+
+	s.fillUrls(item)
+	return nil
+}
+
+func (s *MediaStorage) GetOne(ctx context.Context, id string) (*models.Media, error) {
+	rows, err := s.conn.Query(ctx, "SELECT id::text, \"contentType\", width, height, size,"+
+		"\n \"uploadedBy\", \"createdAt\", keys"+
+		"\n FROM "+s.tableName+
+		"\n WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	var item models.Media
+	if err := pgxscan.ScanOne(&item, rows); err != nil {
+		return nil, err
+	}
+	s.fillUrls(&item)
+	return &item, nil
+}
+
+// GetUrls returns the rendition URLs of every media id in one query.
+func (s *MediaStorage) GetUrls(ctx context.Context, ids []string) (map[string]map[string]string, error) {
+	urls := make(map[string]map[string]string, len(ids))
+	if len(ids) == 0 {
+		return urls, nil
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT id::text, \"contentType\", width, height, size,"+
+		"\n \"uploadedBy\", \"createdAt\", keys"+
+		"\n FROM "+s.tableName+
+		"\n WHERE id = ANY($1::uuid[])", ids)
+	if err != nil {
+		return nil, err
+	}
+	var items []models.Media
+	if err := pgxscan.ScanAll(&items, rows); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		s.fillUrls(&items[i])
+		urls[items[i].Id] = items[i].Urls
+	}
+	return urls, nil
+}
+
+func (s *MediaStorage) Delete(ctx context.Context, id string) error {
+	item, err := s.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.Exec(ctx, "DELETE FROM "+s.tableName+" WHERE id=$1", id); err != nil {
+		return err
+	}
+	s.deleteObjects(ctx, item.Keys)
+	return nil
+}
+
+func (s *MediaStorage) fillUrls(item *models.Media) {
+	item.Urls = make(map[string]string, len(item.Keys))
+	for name, key := range item.Keys {
+		item.Urls[name] = s.store.URL(key)
+	}
+}
+
+// deleteObjects removes objects best effort. It runs even when ctx was cancelled, which
+// is often why a Create is being undone.
+func (s *MediaStorage) deleteObjects(ctx context.Context, keys map[string]string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("error deleting media object", "key", key, "err", err)
+		}
+	}
+}
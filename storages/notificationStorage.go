@@ -0,0 +1,170 @@
+package storages
+
+import (
+	"TaskService/models"
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+type NotificationStorage struct {
+	conn               *pgxpool.Pool
+	logger             *slog.Logger
+	tableName          string
+	bookmarksTableName string
+}
+
+func NewNotificationStorage(logger *slog.Logger, conn *pgxpool.Pool) *NotificationStorage {
+	stor := &NotificationStorage{
+		conn:               conn,
+		logger:             logger,
+		tableName:          "public.\"Notifications\"",
+		bookmarksTableName: "public.\"Bookmarks\"",
+	}
+	stor.createTableIfNotExist()
+
+	return stor
+}
+
+func (s *NotificationStorage) createTableIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n id bigserial NOT NULL,"+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n type text NOT NULL,"+
+		"\n \"postId\" uuid,"+
+		"\n text text NOT NULL,"+
+		"\n \"readAt\" timestamp with time zone,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"Notifications_pkey\" PRIMARY KEY (id),"+
+		"\n CONSTRAINT \"Notifications_postId_fkey\" FOREIGN KEY (\"postId\")"+
+		"\n REFERENCES public.\"Posts\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE SET NULL"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS \"Notifications_userId\" ON "+s.tableName+
+		" (\"userId\", id DESC)")
+	if err != nil {
+		panic(err)
+	}
+}
+
+const notificationColumns = "id, \"userId\", type, \"postId\"::text AS \"postId\", text, \"readAt\", \"createdAt\""
+
+func (s *NotificationStorage) Create(ctx context.Context, userId int64, kind string, postId *string, text string) (*models.Notification, error) {
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.tableName+
+		"\n (\"userId\", type, \"postId\", text) VALUES ($1, $2, $3, $4)"+
+		"\n RETURNING "+notificationColumns, userId, kind, postId, text)
+	if err != nil {
+		return nil, err
+	}
+	var notification models.Notification
+	if err := pgxscan.ScanOne(&notification, rows); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// CreateForBookmarkers notifies every user who bookmarked the post, except the one who changed it.
+func (s *NotificationStorage) CreateForBookmarkers(ctx context.Context, postId string, kind, text string, exceptUserId int64) ([]models.Notification, error) {
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.tableName+
+		"\n (\"userId\", type, \"postId\", text)"+
+		"\n SELECT \"userId\", $2, \"postId\", $3 FROM "+s.bookmarksTableName+
+		"\n WHERE \"postId\"=$1 AND \"userId\"<>$4"+
+		"\n RETURNING "+notificationColumns, postId, kind, text, exceptUserId)
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]models.Notification, 0)
+	if err := pgxscan.ScanAll(&notifications, rows); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// CreateForUsers notifies each of the users, except the one who made the change.
+func (s *NotificationStorage) CreateForUsers(ctx context.Context, userIds []int64, kind string, postId *string, text string, exceptUserId int64) ([]models.Notification, error) {
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.tableName+
+		"\n (\"userId\", type, \"postId\", text)"+
+		"\n SELECT \"userId\", $2, $3, $4 FROM unnest($1::bigint[]) AS \"userId\""+
+		"\n WHERE \"userId\"<>$5"+
+		"\n RETURNING "+notificationColumns, userIds, kind, postId, text, exceptUserId)
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]models.Notification, 0)
+	if err := pgxscan.ScanAll(&notifications, rows); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// GetForUser returns a page of the user's notifications, newest first, the total count
+// of the listed kind and the unread count.
+func (s *NotificationStorage) GetForUser(ctx context.Context, userId int64, unreadOnly bool, size, page int) ([]models.Notification, int, int, error) {
+	var total, unread int
+	if err := s.conn.QueryRow(ctx, "SELECT count(*), count(*) FILTER (WHERE \"readAt\" IS NULL)"+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1", userId).Scan(&total, &unread); err != nil {
+		return nil, 0, 0, err
+	}
+	if unreadOnly {
+		total = unread
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT "+notificationColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1 AND (NOT $2 OR \"readAt\" IS NULL)"+
+		"\n ORDER BY id DESC"+
+		"\n LIMIT $3 OFFSET $4", userId, unreadOnly, size, size*(page-1))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	notifications := make([]models.Notification, 0)
+	if err := pgxscan.ScanAll(&notifications, rows); err != nil {
+		return nil, 0, 0, err
+	}
+	return notifications, total, unread, nil
+}
+
+// GetSince returns up to limit of the user's notifications newer than afterId, oldest first.
+func (s *NotificationStorage) GetSince(ctx context.Context, userId, afterId int64, limit int) ([]models.Notification, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+notificationColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1 AND id>$2"+
+		"\n ORDER BY id"+
+		"\n LIMIT $3", userId, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]models.Notification, 0)
+	if err := pgxscan.ScanAll(&notifications, rows); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkRead marks the user's notifications read, all of them when ids is empty.
+// It returns the unread count left.
+func (s *NotificationStorage) MarkRead(ctx context.Context, userId int64, ids []int64) (int, error) {
+	if ids == nil {
+		ids = []int64{}
+	}
+	_, err := s.conn.Exec(ctx, "UPDATE "+s.tableName+
+		"\n SET \"readAt\"=now()"+
+		"\n WHERE \"userId\"=$1 AND \"readAt\" IS NULL AND (cardinality($2::bigint[]) = 0 OR id = ANY($2::bigint[]))",
+		userId, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	var unread int
+	err = s.conn.QueryRow(ctx, "SELECT count(*) FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1 AND \"readAt\" IS NULL", userId).Scan(&unread)
+	return unread, err
+}
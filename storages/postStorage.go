@@ -2,24 +2,34 @@ package storages
 
 import (
 	"TaskService/db"
+	"TaskService/i18n"
+	"TaskService/logging"
+	"TaskService/markdown"
 	"TaskService/models"
+	"TaskService/tracing"
 	"context"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"time"
 )
 
 type PostStorage struct {
 	conn         *pgxpool.Pool
-	logger       *log.Logger
+	logger       *slog.Logger
 	tableName    string
 	es           *db.EsDb
 	esIndex      string
 	esPostFields []string
+	langs        *i18n.Languages
+	webhooks     *WebhookStorage
 }
 
-func NewPostStorage(logger *log.Logger, conn *pgxpool.Pool, es *db.EsDb) *PostStorage {
+func NewPostStorage(logger *slog.Logger, conn *pgxpool.Pool, es *db.EsDb, langs *i18n.Languages,
+	webhooks *WebhookStorage) *PostStorage {
 	stor := &PostStorage{
 		conn:         conn,
 		logger:       logger,
@@ -27,18 +37,43 @@ func NewPostStorage(logger *log.Logger, conn *pgxpool.Pool, es *db.EsDb) *PostSt
 		es:           es,
 		esIndex:      "post",
 		esPostFields: []string{"title", "content"},
+		langs:        langs,
+		webhooks:     webhooks,
 	}
 	stor.createTableIfNotExist()
 	stor.createIndexIfNotExist()
+	stor.renderMissingHtml()
 
 	return stor
 }
 
 func (s *PostStorage) createIndexIfNotExist() {
-	if err := s.es.CreateIndex(s.esIndex); err != nil {
+	if err := s.es.CreateIndex(context.Background(), s.esIndex); err != nil {
 		panic(err)
 	}
-	s.logger.Println("Created es index ", s.esIndex)
+	s.logger.Info("created es index", "index", s.esIndex)
+
+	if err := s.es.PutMapping(context.Background(), s.esIndex, map[string]interface{}{
+		"rating":    map[string]interface{}{"type": "integer"},
+		"upvotes":   map[string]interface{}{"type": "integer"},
+		"downvotes": map[string]interface{}{"type": "integer"},
+		"wilson":    map[string]interface{}{"type": "float"},
+		"hot":       map[string]interface{}{"type": "double"},
+		"createdAt": map[string]interface{}{"type": "date"},
+	}); err != nil {
+		s.logger.Error("error putting score mapping", "index", s.esIndex, "err", err)
+	}
+
+	// Every language gets its own fields, analyzed with the matching stemmer and stopwords.
+	langFields := make(map[string]interface{})
+	for _, lang := range s.langs.All() {
+		field := map[string]interface{}{"type": "text", "analyzer": i18n.Analyzer(lang)}
+		langFields["title_"+lang] = field
+		langFields["content_"+lang] = field
+	}
+	if err := s.es.PutMapping(context.Background(), s.esIndex, langFields); err != nil {
+		s.logger.Error("error putting language mapping", "index", s.esIndex, "err", err)
+	}
 }
 
 func (s *PostStorage) createTableIfNotExist() {
@@ -48,16 +83,67 @@ func (s *PostStorage) createTableIfNotExist() {
 		"\n    content text COLLATE pg_catalog.\"default\","+
 		"\n    rating integer NOT NULL DEFAULT 0,"+
 		"\n    img text COLLATE pg_catalog.\"default\","+
+		"\n    upvotes integer NOT NULL DEFAULT 0,"+
+		"\n    downvotes integer NOT NULL DEFAULT 0,"+
+		"\n    \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n    \"mediaId\" uuid,"+
+		"\n    \"contentHtml\" text,"+
 		"\n    CONSTRAINT \"Posts_pkey\" PRIMARY KEY (id)"+
 		"\n    )")
 	if err != nil {
 
 		panic(err)
 	}
+
+	_, err = s.conn.Exec(context.Background(), "ALTER TABLE "+s.tableName+
+		"\n ADD COLUMN IF NOT EXISTS upvotes integer NOT NULL DEFAULT 0,"+
+		"\n ADD COLUMN IF NOT EXISTS downvotes integer NOT NULL DEFAULT 0,"+
+		"\n ADD COLUMN IF NOT EXISTS \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n ADD COLUMN IF NOT EXISTS \"mediaId\" uuid,"+
+		"\n ADD COLUMN IF NOT EXISTS \"contentHtml\" text")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// renderMissingHtml renders the content of posts created before contentHtml existed
+// and reindexes their search text without Markdown syntax.
+func (s *PostStorage) renderMissingHtml() {
+	rows, err := s.conn.Query(context.Background(), "select * from "+s.tableName+
+		" where \"contentHtml\" is null and content is not null")
+	if err != nil {
+		panic(err)
+	}
+	var posts []models.Post
+	if err := pgxscan.ScanAll(&posts, rows); err != nil {
+		panic(err)
+	}
+
+	for _, post := range posts {
+		contentHtml, contentText, err := renderContent(*post.Content)
+		if err != nil {
+			s.logger.Error("error rendering content", "post", post.Id, "err", err)
+			continue
+		}
+		if _, err := s.conn.Exec(context.Background(), "update "+s.tableName+
+			" set \"contentHtml\"=$2 where id=$1", post.Id, contentHtml); err != nil {
+			s.logger.Error("error saving content html", "post", post.Id, "err", err)
+			continue
+		}
+		if err := s.es.Update(context.Background(), s.esIndex, post.Id, &models.PostES{Id: post.Id, Title: post.Title, Content: contentText}); err != nil {
+			s.logger.Error("error reindexing content", "post", post.Id, "err", err)
+		}
+	}
+	if len(posts) > 0 {
+		s.logger.Info("rendered content html", "posts", len(posts))
+	}
 }
 
-func (s *PostStorage) GetOne(id string) (*models.Post, error) {
-	row, err := s.conn.Query(context.Background(), "select * from "+s.tableName+" where id=$1 limit 1;", id)
+func (s *PostStorage) GetOne(ctx context.Context, id string) (_ *models.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.GetOne", attribute.String("post.id", id))
+	defer tracing.End(span, &err)
+
+	row, err := s.conn.Query(ctx, "select * from "+s.tableName+" where id=$1 limit 1;", id)
 	if err != nil {
 		return nil, err
 	}
@@ -71,10 +157,13 @@ func (s *PostStorage) GetOne(id string) (*models.Post, error) {
 	return &post, nil
 }
 
-func (s *PostStorage) GetAll(limit int) ([]models.Post, error) {
-	rows, err := s.conn.Query(context.Background(), "select * from "+s.tableName+" limit $1", limit)
+func (s *PostStorage) GetAll(ctx context.Context, limit int, sort PostSort) (_ []models.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.GetAll", attribute.Int("limit", limit))
+	defer tracing.End(span, &err)
+
+	rows, err := s.conn.Query(ctx, "select * from "+s.tableName+sortOrderSql(sort)+" limit $1", limit)
 	if err != nil {
-		s.logger.Println("Error in GetAll() \nError: ", err.Error())
+		logging.FromContext(ctx).Error("error getting posts", "limit", limit, "sort", sort, "err", err)
 		return nil, err
 	}
 	var posts []models.Post
@@ -84,8 +173,11 @@ func (s *PostStorage) GetAll(limit int) ([]models.Post, error) {
 	return posts, nil
 }
 
-func (s *PostStorage) GetMany(ids []string) ([]models.Post, error) {
-	rows, err := s.conn.Query(context.Background(), "select * from "+s.tableName+" where id = ANY($1::uuid[])", ids)
+func (s *PostStorage) GetMany(ctx context.Context, ids []string) (_ []models.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.GetMany", attribute.Int("ids", len(ids)))
+	defer tracing.End(span, &err)
+
+	rows, err := s.conn.Query(ctx, "select * from "+s.tableName+" where id = ANY($1::uuid[])", ids)
 	if err != nil {
 		return nil, err
 	}
@@ -100,26 +192,51 @@ func (s *PostStorage) GetMany(ids []string) ([]models.Post, error) {
 	return tasks, nil
 }
 
-func (s *PostStorage) Create(title, content, img string) (string, error) {
+func (s *PostStorage) Create(ctx context.Context, newPost *models.PostAddDTO) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.Create")
+	defer tracing.End(span, &err)
+
+	contentHtml, contentText, err := renderContent(newPost.Content)
+	if err != nil {
+		return "", err
+	}
+
 	id := uuid.New().String()
-	_, err := s.conn.Exec(context.Background(), "Insert into "+s.tableName+
-		" (id, title, content, img) values ($1, $2, $3, $4)", id, title, content, img)
+	var createdAt time.Time
+	err = pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "Insert into "+s.tableName+
+			" (id, title, content, img, \"mediaId\", \"contentHtml\") values ($1, $2, $3, $4, $5, $6) returning *",
+			id, newPost.Title, newPost.Content, newPost.Img, nullIfEmpty(newPost.MediaId), contentHtml)
+		if err != nil {
+			return err
+		}
+		var post models.Post
+		if err := pgxscan.ScanOne(&post, rows); err != nil {
+			return err
+		}
+		createdAt = post.CreatedAt
+		return s.webhooks.enqueue(ctx, tx, models.EventPostCreated, post)
+	})
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	post := models.PostES{
-		Id:      id,
-		Title:   title,
-		Content: content,
+		Id:           id,
+		Title:        newPost.Title,
+		Content:      contentText,
+		PostScoresES: &models.PostScoresES{CreatedAt: createdAt, Hot: HotScore(0, 0, createdAt)},
+	}
+	if err := s.es.Index(ctx, s.esIndex, id, post); err != nil {
+		return "", err
 	}
-	if err := s.es.Index(s.esIndex, id, post); err != nil {
-		return "", nil
+	if err := s.indexLang(ctx, id, s.langs.Default, newPost.Title, contentText); err != nil {
+		return "", err
 	}
-	return id, err
+	return id, nil
 }
 
-func (s *PostStorage) ChangeRatingRelatively(id string, delta int) (int, error) {
-	rows, err := s.conn.Query(context.Background(), "UPDATE "+s.tableName+
+func (s *PostStorage) ChangeRatingRelatively(ctx context.Context, id string, delta int) (int, error) {
+	rows, err := s.conn.Query(ctx, "UPDATE "+s.tableName+
 		"\n set rating=rating+$2"+
 		"\n where id=$1"+
 		"\n returning rating", id, delta)
@@ -135,47 +252,168 @@ func (s *PostStorage) ChangeRatingRelatively(id string, delta int) (int, error)
 	return newRating, nil
 }
 
-func (s *PostStorage) Update(newPost *models.Post) error {
-	_, err := s.conn.Exec(context.Background(), "update "+s.tableName+
-		" set title=$2,"+
-		" content=$3,"+
-		" rating=$4,"+
-		" img=$5 "+
-		"where id=$1", newPost.Id, newPost.Title, newPost.Content, newPost.Rating, newPost.Img)
+func (s *PostStorage) Update(ctx context.Context, newPost *models.PostUpdateDTO) (_ *models.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.Update", attribute.String("post.id", newPost.Id))
+	defer tracing.End(span, &err)
 
+	content := ""
+	if newPost.Content != nil {
+		content = *newPost.Content
+	}
+	contentHtml, contentText, err := renderContent(content)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var post models.Post
+	err = pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "update "+s.tableName+
+			" set title=$2,"+
+			" content=$3,"+
+			" img=$4,"+
+			" \"mediaId\"=$5,"+
+			" \"contentHtml\"=$6 "+
+			"where id=$1 returning *", newPost.Id, newPost.Title, newPost.Content, newPost.Img, newPost.MediaId, contentHtml)
+		if err != nil {
+			return err
+		}
+		if err := pgxscan.ScanOne(&post, rows); err != nil {
+			if pgxscan.NotFound(err) {
+				return pgx.ErrNoRows
+			}
+			return err
+		}
+		return s.webhooks.enqueue(ctx, tx, models.EventPostUpdated, post)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	postES := &models.PostES{
-		Id:    newPost.Id,
-		Title: newPost.Title,
+		Id:      newPost.Id,
+		Title:   newPost.Title,
+		Content: contentText,
 	}
-	if newPost.Content != nil {
-		postES.Content = *newPost.Content
+
+	if err := s.es.Update(ctx, s.esIndex, newPost.Id, postES); err != nil {
+		return nil, err
+	}
+	if err := s.indexLang(ctx, newPost.Id, s.langs.Default, newPost.Title, contentText); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// IndexTranslation puts a translation into the language fields of the post document.
+func (s *PostStorage) IndexTranslation(ctx context.Context, translation *models.PostTranslation) error {
+	content := ""
+	if translation.Content != nil {
+		content = *translation.Content
+	}
+	contentText, err := markdown.ToPlainText(content)
+	if err != nil {
+		return err
 	}
+	return s.indexLang(ctx, translation.PostId, translation.Lang, translation.Title, contentText)
+}
+
+// RemoveTranslation clears the language fields of the post document.
+func (s *PostStorage) RemoveTranslation(ctx context.Context, postId, lang string) error {
+	return s.es.Update(ctx, s.esIndex, postId, map[string]interface{}{
+		"title_" + lang:   nil,
+		"content_" + lang: nil,
+	})
+}
+
+func (s *PostStorage) indexLang(ctx context.Context, id, lang, title, contentText string) error {
+	return s.es.Update(ctx, s.esIndex, id, map[string]interface{}{
+		"title_" + lang:   title,
+		"content_" + lang: contentText,
+	})
+}
+
+// IndexScores copies the post's current vote counts and scores to its search document.
+func (s *PostStorage) IndexScores(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.IndexScores", attribute.String("post.id", id))
+	defer tracing.End(span, &err)
+
+	post, err := s.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.es.Update(ctx, s.esIndex, id, &models.PostScoresES{
+		Rating:    post.Rating,
+		Upvotes:   post.Upvotes,
+		Downvotes: post.Downvotes,
+		Wilson:    WilsonScore(post.Upvotes, post.Downvotes),
+		Hot:       HotScore(post.Upvotes, post.Downvotes, post.CreatedAt),
+		CreatedAt: post.CreatedAt,
+	})
+}
 
-	err = s.es.Update(s.esIndex, newPost.Id, newPost)
-	return err
+// ReindexScores runs IndexScores for every post, e.g. to fill a new score field. It
+// returns the number of posts reindexed and keeps going past single failures.
+func (s *PostStorage) ReindexScores(ctx context.Context) (int, error) {
+	rows, err := s.conn.Query(ctx, "select id from "+s.tableName)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+	reindexed := 0
+	for _, id := range ids {
+		if err := s.IndexScores(ctx, id); err != nil {
+			s.logger.Error("error reindexing scores", "post", id, "err", err)
+			continue
+		}
+		reindexed++
+	}
+	return reindexed, nil
 }
 
-func (s *PostStorage) Delete(id string) error {
-	err := s.es.Delete(s.esIndex, id)
+func (s *PostStorage) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.Delete", attribute.String("post.id", id))
+	defer tracing.End(span, &err)
+
+	err = s.es.Delete(ctx, s.esIndex, id)
 	if err != nil {
 		return err
 	}
-	_, err = s.conn.Exec(context.Background(), "delete from "+s.tableName+
-		"where id=$1", id)
-	return err
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "delete from "+s.tableName+
+			" where id=$1", id)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		return s.webhooks.enqueue(ctx, tx, models.EventPostDeleted, struct {
+			Id string `json:"id"`
+		}{Id: id})
+	})
 }
 
-func (s *PostStorage) SearchES(query string, size, page int) (*struct {
+// SearchES matches the query against the text of every language, preferring lang.
+func (s *PostStorage) SearchES(ctx context.Context, query string, size, page int, sort PostSort, lang string) (_ *struct {
 	Total int
 	Ids   []string
-}, error) {
-	res, err := s.es.Search(s.esIndex, query, s.esPostFields, size, page)
+}, err error) {
+	ctx, span := tracing.Start(ctx, "PostStorage.SearchES", attribute.String("sort", string(sort)))
+	defer tracing.End(span, &err)
+
+	fields := append([]string{}, s.esPostFields...)
+	for _, supported := range s.langs.All() {
+		boost := ""
+		if supported == lang {
+			boost = "^2"
+		}
+		fields = append(fields, "title_"+supported+boost, "content_"+supported+boost)
+	}
+
+	res, err := s.es.SearchScored(ctx, s.esIndex, query, fields, size, page, esScoreFunctions(sort), esBoostMode(sort))
 	if err != nil {
-		s.logger.Println("Error in SearchES, \nError: ", err.Error())
+		logging.FromContext(ctx).Error("error searching es", "query", query, "err", err)
 		return nil, err
 	}
 
@@ -189,3 +427,23 @@ func (s *PostStorage) SearchES(query string, size, page int) (*struct {
 		Ids   []string
 	}{Total: len(ids), Ids: ids}, nil
 }
+
+func nullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// renderContent returns the sanitized HTML of Markdown content and its plain text for search.
+func renderContent(content string) (string, string, error) {
+	contentHtml, err := markdown.ToHTML(content)
+	if err != nil {
+		return "", "", err
+	}
+	contentText, err := markdown.ToPlainText(content)
+	if err != nil {
+		return "", "", err
+	}
+	return contentHtml, contentText, nil
+}
@@ -0,0 +1,113 @@
+package storages
+
+import (
+	"math"
+	"time"
+)
+
+type PostSort string
+
+const (
+	SortNone PostSort = ""
+	SortBest PostSort = "best"
+	SortHot  PostSort = "hot"
+	SortTop  PostSort = "top"
+)
+
+func (s PostSort) Valid() bool {
+	switch s {
+	case SortNone, SortBest, SortHot, SortTop:
+		return true
+	}
+	return false
+}
+
+const (
+	// wilsonZ is the normal quantile for a 95% confidence interval.
+	wilsonZ = 1.96
+	// hotPeriod is the age in seconds that weighs as much as a tenfold net score.
+	hotPeriod = 45000
+)
+
+// WilsonScore is the lower bound of the Wilson confidence interval for the share
+// of upvotes, so +3/-0 ranks below +103/-100 only while the evidence is thin.
+func WilsonScore(upvotes, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+	z2 := wilsonZ * wilsonZ
+	p := float64(upvotes) / n
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// HotScore is a log-scaled net score shifted by post age, so newer posts outrank older ones.
+// It is indexed with the scores, so search ranks "hot" exactly as the post list does.
+func HotScore(upvotes, downvotes int, createdAt time.Time) float64 {
+	net := float64(upvotes - downvotes)
+	order := math.Log10(math.Max(math.Abs(net), 1))
+	sign := 0.0
+	if net > 0 {
+		sign = 1
+	} else if net < 0 {
+		sign = -1
+	}
+	return sign*order + float64(createdAt.Unix())/hotPeriod
+}
+
+// sortOrderSql returns the ORDER BY clause for sort; the expressions mirror WilsonScore and HotScore.
+func sortOrderSql(sort PostSort) string {
+	switch sort {
+	case SortBest:
+		return " ORDER BY CASE WHEN upvotes + downvotes = 0 THEN 0 ELSE" +
+			" (upvotes::float8 / (upvotes + downvotes) + 1.9208 / (upvotes + downvotes)" +
+			" - 1.96 * SQRT(upvotes::float8 * downvotes / (upvotes + downvotes) + 0.9604) / (upvotes + downvotes))" +
+			" / (1 + 3.8416 / (upvotes + downvotes)) END DESC, \"createdAt\" DESC"
+	case SortHot:
+		return " ORDER BY SIGN(upvotes - downvotes) * LOG(GREATEST(ABS(upvotes - downvotes), 1))" +
+			" + EXTRACT(EPOCH FROM \"createdAt\") / 45000 DESC"
+	case SortTop:
+		return " ORDER BY rating DESC, \"createdAt\" DESC"
+	}
+	return ""
+}
+
+// esBoostMode returns how the functions of sort combine with text relevance. Hot hits are
+// ordered by the indexed HotScore alone, like GET /post; the other sorts boost relevance.
+func esBoostMode(sort PostSort) string {
+	if sort == SortHot {
+		return "replace"
+	}
+	return "multiply"
+}
+
+// esScoreFunctions returns the function_score functions for sort.
+func esScoreFunctions(sort PostSort) []map[string]interface{} {
+	wilson := map[string]interface{}{
+		"field_value_factor": map[string]interface{}{
+			"field":    "wilson",
+			"modifier": "ln2p",
+			"missing":  0,
+		},
+	}
+	switch sort {
+	case SortBest:
+		return []map[string]interface{}{wilson}
+	case SortHot:
+		return []map[string]interface{}{{
+			"field_value_factor": map[string]interface{}{
+				"field":   "hot",
+				"missing": 0,
+			},
+		}}
+	case SortTop:
+		return []map[string]interface{}{{
+			"script_score": map[string]interface{}{
+				"script": map[string]interface{}{
+					"source": "doc['rating'].size() == 0 ? Math.log(2) : Math.log(2 + Math.max(doc['rating'].value, 0))",
+				},
+			},
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package storages
+
+import (
+	"TaskService/models"
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// ReminderStorage keeps reminder preferences and the reminder queue. A reminder is
+// enqueued once per user, item and deadline, and claimed by a sender with a lease:
+// a reminder whose sender died before marking it sent is claimed again after the lease.
+type ReminderStorage struct {
+	conn                 *pgxpool.Pool
+	logger               *slog.Logger
+	tableName            string
+	preferencesTableName string
+}
+
+func NewReminderStorage(logger *slog.Logger, conn *pgxpool.Pool) *ReminderStorage {
+	stor := &ReminderStorage{
+		conn:                 conn,
+		logger:               logger,
+		tableName:            "public.\"Reminders\"",
+		preferencesTableName: "public.\"ReminderPreferences\"",
+	}
+	stor.createTablesIfNotExist()
+
+	return stor
+}
+
+func (s *ReminderStorage) createTablesIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.preferencesTableName+
+		"\n ("+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n \"daysBefore\" integer NOT NULL,"+
+		"\n \"startedOnly\" boolean NOT NULL DEFAULT false,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"ReminderPreferences_pkey\" PRIMARY KEY (\"userId\")"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "ALTER TABLE "+s.preferencesTableName+
+		"\n ADD COLUMN IF NOT EXISTS \"startedOnly\" boolean NOT NULL DEFAULT false")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n id uuid NOT NULL DEFAULT gen_random_uuid(),"+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n \"itemId\" uuid NOT NULL,"+
+		"\n deadline timestamp with time zone NOT NULL,"+
+		"\n status text NOT NULL DEFAULT 'pending',"+
+		"\n attempts integer NOT NULL DEFAULT 0,"+
+		"\n \"nextAttemptAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n \"lastError\" text,"+
+		"\n \"sentAt\" timestamp with time zone,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"Reminders_pkey\" PRIMARY KEY (id),"+
+		"\n CONSTRAINT \"Reminders_dedup\" UNIQUE (\"userId\", \"itemId\", deadline),"+
+		"\n CONSTRAINT \"Reminders_itemId_fkey\" FOREIGN KEY (\"itemId\")"+
+		"\n REFERENCES public.\"ChecklistItems\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS \"Reminders_due\" ON "+s.tableName+
+		" (\"nextAttemptAt\") WHERE status = 'pending'")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetPreference returns the user's reminder preference. pgx.ErrNoRows means the user has not opted in.
+func (s *ReminderStorage) GetPreference(ctx context.Context, userId int64) (*models.ReminderPreference, error) {
+	rows, err := s.conn.Query(ctx, "SELECT * FROM "+s.preferencesTableName+
+		"\n WHERE \"userId\"=$1", userId)
+	if err != nil {
+		return nil, err
+	}
+	var preference models.ReminderPreference
+	if err := pgxscan.ScanOne(&preference, rows); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, err
+	}
+	return &preference, nil
+}
+
+// SetPreference opts the user in to reminders daysBefore days before deadlines, only in
+// the checklists they have started when startedOnly is set. Pending reminders enqueued
+// with an older preference are still sent.
+func (s *ReminderStorage) SetPreference(ctx context.Context, userId int64, daysBefore int, startedOnly bool) (*models.ReminderPreference, error) {
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.preferencesTableName+
+		"\n (\"userId\", \"daysBefore\", \"startedOnly\") VALUES ($1, $2, $3)"+
+		"\n ON CONFLICT (\"userId\") DO UPDATE"+
+		"\n SET \"daysBefore\"=EXCLUDED.\"daysBefore\", \"startedOnly\"=EXCLUDED.\"startedOnly\""+
+		"\n RETURNING *", userId, daysBefore, startedOnly)
+	if err != nil {
+		return nil, err
+	}
+	var preference models.ReminderPreference
+	if err := pgxscan.ScanOne(&preference, rows); err != nil {
+		return nil, err
+	}
+	return &preference, nil
+}
+
+// DeletePreference opts the user out and cancels their pending reminders.
+func (s *ReminderStorage) DeletePreference(ctx context.Context, userId int64) (bool, error) {
+	var deleted bool
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM "+s.preferencesTableName+
+			"\n WHERE \"userId\"=$1", userId)
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected() > 0
+
+		_, err = tx.Exec(ctx, "UPDATE "+s.tableName+
+			"\n SET status='"+models.ReminderCancelled+"'"+
+			"\n WHERE \"userId\"=$1 AND status='"+models.ReminderPending+"'", userId)
+		return err
+	})
+	return deleted, err
+}
+
+const reminderColumns = "r.id::text AS id, r.\"userId\", r.\"itemId\"::text AS \"itemId\", i.title AS \"itemTitle\"," +
+	" c.id::text AS \"checklistId\", c.title AS \"checklistTitle\", r.deadline, r.status, r.attempts," +
+	" r.\"lastError\", r.\"sentAt\", r.\"createdAt\""
+
+// GetForUser returns a page of the user's reminders, newest first, and the total count.
+func (s *ReminderStorage) GetForUser(ctx context.Context, userId int64, size, page int) ([]models.Reminder, int, error) {
+	var total int
+	if err := s.conn.QueryRow(ctx, "SELECT count(*) FROM "+s.tableName+
+		"\n WHERE \"userId\"=$1", userId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT "+reminderColumns+
+		"\n FROM "+s.tableName+" r"+
+		"\n JOIN public.\"ChecklistItems\" i ON i.id = r.\"itemId\""+
+		"\n JOIN public.\"Checklists\" c ON c.id = i.\"checklistId\""+
+		"\n WHERE r.\"userId\"=$1"+
+		"\n ORDER BY r.\"createdAt\" DESC"+
+		"\n LIMIT $2 OFFSET $3", userId, size, size*(page-1))
+	if err != nil {
+		return nil, 0, err
+	}
+	reminders := make([]models.Reminder, 0)
+	if err := pgxscan.ScanAll(&reminders, rows); err != nil {
+		return nil, 0, err
+	}
+	return reminders, total, nil
+}
+
+// EnqueueDue queues a reminder for every opted in user and upcoming dated item within
+// the user's reminder window, unless the user has done the item. Users who asked for
+// started checklists only are not reminded about checklists without a ticked item.
+// Already queued reminders are not queued again, so it's safe to run any number of times.
+func (s *ReminderStorage) EnqueueDue(ctx context.Context) (int64, error) {
+	tag, err := s.conn.Exec(ctx, "INSERT INTO "+s.tableName+
+		"\n (\"userId\", \"itemId\", deadline)"+
+		"\n SELECT p.\"userId\", i.id, i.deadline"+
+		"\n FROM "+s.preferencesTableName+" p"+
+		"\n JOIN public.\"ChecklistItems\" i ON NOT p.\"startedOnly\" OR EXISTS (SELECT 1 FROM public.\"ChecklistProgress\" sd"+
+		"\n JOIN public.\"ChecklistItems\" si ON si.id = sd.\"itemId\""+
+		"\n WHERE sd.\"userId\" = p.\"userId\" AND si.\"checklistId\" = i.\"checklistId\")"+
+		"\n WHERE i.deadline IS NOT NULL AND i.deadline > now()"+
+		"\n AND i.deadline - make_interval(days => p.\"daysBefore\") <= now()"+
+		"\n AND NOT EXISTS (SELECT 1 FROM public.\"ChecklistProgress\" d"+
+		"\n WHERE d.\"userId\" = p.\"userId\" AND d.\"itemId\" = i.id)"+
+		"\n ON CONFLICT (\"userId\", \"itemId\", deadline) DO NOTHING")
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ClaimDue leases up to limit due reminders to the caller for lease and counts the attempt.
+// Reminders that became pointless, since the item is done, its deadline moved or passed,
+// are cancelled first.
+func (s *ReminderStorage) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.Reminder, error) {
+	_, err := s.conn.Exec(ctx, "UPDATE "+s.tableName+" r"+
+		"\n SET status='"+models.ReminderCancelled+"'"+
+		"\n FROM public.\"ChecklistItems\" i"+
+		"\n WHERE i.id = r.\"itemId\" AND r.status='"+models.ReminderPending+"'"+
+		"\n AND (i.deadline IS DISTINCT FROM r.deadline OR r.deadline <= now()"+
+		"\n OR EXISTS (SELECT 1 FROM public.\"ChecklistProgress\" d"+
+		"\n WHERE d.\"userId\" = r.\"userId\" AND d.\"itemId\" = r.\"itemId\"))")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query(ctx, "UPDATE "+s.tableName+" r"+
+		"\n SET attempts=r.attempts+1, \"nextAttemptAt\"=now() + make_interval(secs => $2)"+
+		"\n FROM public.\"ChecklistItems\" i"+
+		"\n JOIN public.\"Checklists\" c ON c.id = i.\"checklistId\""+
+		"\n WHERE i.id = r.\"itemId\" AND r.id IN (SELECT id FROM "+s.tableName+
+		"\n WHERE status='"+models.ReminderPending+"' AND \"nextAttemptAt\" <= now()"+
+		"\n ORDER BY \"nextAttemptAt\""+
+		"\n LIMIT $1"+
+		"\n FOR UPDATE SKIP LOCKED)"+
+		"\n RETURNING "+reminderColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	reminders := make([]models.Reminder, 0)
+	if err := pgxscan.ScanAll(&reminders, rows); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+func (s *ReminderStorage) MarkSent(ctx context.Context, id string) error {
+	_, err := s.conn.Exec(ctx, "UPDATE "+s.tableName+
+		"\n SET status='"+models.ReminderSent+"', \"sentAt\"=now(), \"lastError\"=NULL"+
+		"\n WHERE id=$1", id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The reminder is retried at retryAt, or given up on when it's nil.
+func (s *ReminderStorage) MarkFailed(ctx context.Context, id string, sendErr error, retryAt *time.Time) error {
+	status := models.ReminderPending
+	if retryAt == nil {
+		status = models.ReminderFailed
+	}
+	_, err := s.conn.Exec(ctx, "UPDATE "+s.tableName+
+		"\n SET status=$2, \"lastError\"=$3, \"nextAttemptAt\"=COALESCE($4, \"nextAttemptAt\")"+
+		"\n WHERE id=$1", id, status, sendErr.Error(), retryAt)
+	return err
+}
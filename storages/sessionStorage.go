@@ -2,11 +2,16 @@ package storages
 
 import (
 	"TaskService/db"
+	"TaskService/logging"
 	"TaskService/models/cache"
+	"TaskService/tracing"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 )
@@ -15,12 +20,15 @@ var (
 	redisKeySessionToken = "session_storage"
 )
 
+// ErrSessionNotFound is a token without a session, either unknown or expired.
+var ErrSessionNotFound = errors.New("session not found")
+
 type SessionStorage struct {
 	redis  *db.RedisDb
-	logger *log.Logger
+	logger *slog.Logger
 }
 
-func NewSessionStorage(redis *db.RedisDb, logger *log.Logger) *SessionStorage {
+func NewSessionStorage(redis *db.RedisDb, logger *slog.Logger) *SessionStorage {
 	stor := &SessionStorage{
 		redis:  redis,
 		logger: logger,
@@ -29,30 +37,45 @@ func NewSessionStorage(redis *db.RedisDb, logger *log.Logger) *SessionStorage {
 	return stor
 }
 
-func (s *SessionStorage) CreateSession(userVk *cache.UserVk) (string, error) {
+func (s *SessionStorage) CreateSession(ctx context.Context, userVk *cache.UserVk) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "SessionStorage.CreateSession")
+	defer tracing.End(span, &err)
+
 	sessionToken := uuid.New().String()
 	sessionKey := makeSessionKey(sessionToken)
+	if userVk.CreatedAt.IsZero() {
+		userVk.CreatedAt = time.Now()
+	}
 	duration := userVk.Token.Expiry.Sub(time.Now())
-	s.logger.Println("Setting token: ", sessionToken, " with duration: ", duration)
-	err := s.redis.Set(sessionKey, userVk, duration)
+	logging.FromContext(ctx).Debug("creating session", "user", userVk.Info.Id, "token", logging.Redact(sessionToken), "duration", duration)
+	err = s.redis.Set(ctx, sessionKey, userVk, duration)
 	return sessionToken, err
 }
 
-func (s *SessionStorage) DeleteSession(sessionToken string) error {
+func (s *SessionStorage) DeleteSession(ctx context.Context, sessionToken string) (err error) {
+	ctx, span := tracing.Start(ctx, "SessionStorage.DeleteSession")
+	defer tracing.End(span, &err)
+
 	sessionKey := makeSessionKey(sessionToken)
-	return s.redis.Delete(sessionKey)
+	return s.redis.Delete(ctx, sessionKey)
 }
 
-func (s *SessionStorage) GetSession(sessionToken string) (*cache.UserVk, error) {
+func (s *SessionStorage) GetSession(ctx context.Context, sessionToken string) (_ *cache.UserVk, err error) {
+	ctx, span := tracing.Start(ctx, "SessionStorage.GetSession")
+	defer tracing.End(span, &err)
+
 	key := makeSessionKey(sessionToken)
-	val, err := s.redis.Get(key)
+	val, err := s.redis.Get(ctx, key)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
 	if err != nil {
-		return nil, errors.New("key not found")
+		return nil, fmt.Errorf("getting session: %w", err)
 	}
 
 	var userVk *cache.UserVk
 	if err := json.NewDecoder(strings.NewReader(val)).Decode(&userVk); err != nil {
-		return nil, errors.New("error decoding token")
+		return nil, fmt.Errorf("decoding session: %w", err)
 	}
 	return userVk, nil
 }
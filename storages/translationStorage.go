@@ -0,0 +1,118 @@
+package storages
+
+import (
+	"TaskService/models"
+	"context"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+type TranslationStorage struct {
+	conn      *pgxpool.Pool
+	logger    *slog.Logger
+	tableName string
+}
+
+func NewTranslationStorage(logger *slog.Logger, conn *pgxpool.Pool) *TranslationStorage {
+	stor := &TranslationStorage{
+		conn:      conn,
+		logger:    logger,
+		tableName: "public.\"PostTranslations\"",
+	}
+	stor.createTableIfNotExist()
+
+	return stor
+}
+
+func (s *TranslationStorage) createTableIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n \"postId\" uuid NOT NULL,"+
+		"\n lang text NOT NULL,"+
+		"\n title text NOT NULL,"+
+		"\n content text,"+
+		"\n \"contentHtml\" text,"+
+		"\n \"updatedAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"PostTranslations_pkey\" PRIMARY KEY (\"postId\", lang),"+
+		"\n CONSTRAINT \"PostTranslations_postId_fkey\" FOREIGN KEY (\"postId\")"+
+		"\n REFERENCES public.\"Posts\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+}
+
+const translationColumns = "\"postId\"::text AS \"postId\", lang, title, content, \"contentHtml\", \"updatedAt\""
+
+func (s *TranslationStorage) GetAll(ctx context.Context, postId string) ([]models.PostTranslation, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+translationColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"postId\"=$1"+
+		"\n ORDER BY lang", postId)
+	if err != nil {
+		return nil, err
+	}
+	translations := make([]models.PostTranslation, 0)
+	if err := pgxscan.ScanAll(&translations, rows); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// GetMany returns the translations of postIds into lang in one query, keyed by post id.
+func (s *TranslationStorage) GetMany(ctx context.Context, postIds []string, lang string) (map[string]models.PostTranslation, error) {
+	byPost := make(map[string]models.PostTranslation, len(postIds))
+	if len(postIds) == 0 {
+		return byPost, nil
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT "+translationColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"postId\" = ANY($1::uuid[]) AND lang=$2", postIds, lang)
+	if err != nil {
+		return nil, err
+	}
+	var translations []models.PostTranslation
+	if err := pgxscan.ScanAll(&translations, rows); err != nil {
+		return nil, err
+	}
+	for _, translation := range translations {
+		byPost[translation.PostId] = translation
+	}
+	return byPost, nil
+}
+
+// Upsert creates or replaces the translation and returns it as stored.
+func (s *TranslationStorage) Upsert(ctx context.Context, postId, lang string, translation *models.PostTranslationDTO) (*models.PostTranslation, error) {
+	contentHtml, _, err := renderContent(translation.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.tableName+
+		"\n (\"postId\", lang, title, content, \"contentHtml\") VALUES ($1, $2, $3, $4, $5)"+
+		"\n ON CONFLICT (\"postId\", lang) DO UPDATE SET title=EXCLUDED.title, content=EXCLUDED.content,"+
+		"\n \"contentHtml\"=EXCLUDED.\"contentHtml\", \"updatedAt\"=now()"+
+		"\n RETURNING "+translationColumns, postId, lang, translation.Title, translation.Content, contentHtml)
+	if err != nil {
+		return nil, err
+	}
+	var stored models.PostTranslation
+	if err := pgxscan.ScanOne(&stored, rows); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// Delete removes the translation and reports whether it existed.
+func (s *TranslationStorage) Delete(ctx context.Context, postId, lang string) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "DELETE FROM "+s.tableName+
+		"\n WHERE \"postId\"=$1 AND lang=$2", postId, lang)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -2,11 +2,15 @@ package storages
 
 import (
 	"TaskService/models"
+	"TaskService/models/cache"
+	"TaskService/tracing"
 	"context"
 	"errors"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
 )
 
 var (
@@ -19,18 +23,25 @@ var (
 )
 
 type UserPostRatingStorage struct {
-	conn      *pgxpool.Pool
-	logger    *log.Logger
-	tableName string
+	conn           *pgxpool.Pool
+	logger         *slog.Logger
+	tableName      string
+	postsTableName string
+	flagsTableName string
+	anomalyRules   VoteAnomalyRules
 }
 
-func NewUserPostRatingStorage(logger *log.Logger, conn *pgxpool.Pool) *UserPostRatingStorage {
+func NewUserPostRatingStorage(logger *slog.Logger, conn *pgxpool.Pool, anomalyRules VoteAnomalyRules) *UserPostRatingStorage {
 	stor := &UserPostRatingStorage{
-		conn:      conn,
-		logger:    logger,
-		tableName: "public.\"UserPostRating\"",
+		conn:           conn,
+		logger:         logger,
+		tableName:      "public.\"UserPostRating\"",
+		postsTableName: "public.\"Posts\"",
+		flagsTableName: "public.\"VoteFlags\"",
+		anomalyRules:   anomalyRules,
 	}
 	stor.createTableIfNotExist()
+	stor.createFlagsTableIfNotExist()
 
 	return stor
 }
@@ -50,10 +61,18 @@ func (s *UserPostRatingStorage) createTableIfNotExist() {
 	if err != nil {
 		panic(err)
 	}
+
+	_, err = s.conn.Exec(context.Background(), "ALTER TABLE "+s.tableName+
+		"\n ADD COLUMN IF NOT EXISTS \"votedAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n ADD COLUMN IF NOT EXISTS \"newSession\" boolean NOT NULL DEFAULT false,"+
+		"\n ADD COLUMN IF NOT EXISTS quarantined boolean NOT NULL DEFAULT false")
+	if err != nil {
+		panic(err)
+	}
 }
 
-func (s *UserPostRatingStorage) GetUserOper(userId int64, postId string) (*models.UserPostRating, error) {
-	row, err := s.conn.Query(context.Background(), "SELECT \"userId\", \"postId\", oper "+
+func (s *UserPostRatingStorage) GetUserOper(ctx context.Context, userId int64, postId string) (*models.UserPostRating, error) {
+	row, err := s.conn.Query(ctx, "SELECT \"userId\", \"postId\", oper "+
 		"\n FROM public.\"UserPostRating\""+
 		"\n WHERE \"postId\" = $1"+
 		"\n AND \"userId\" = $2 LIMIT 1;", postId, userId)
@@ -63,63 +82,203 @@ func (s *UserPostRatingStorage) GetUserOper(userId int64, postId string) (*model
 
 	var userPostRating models.UserPostRating
 	if err := pgxscan.ScanOne(&userPostRating, row); err != nil {
-		if pgxscan.NotFound(err) {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	return &userPostRating, nil
 }
 
-func (s *UserPostRatingStorage) SetUserOper(userPostRating *models.UserPostRating) error {
-	if !s.OperAllowed(userPostRating.Oper) {
-		return NewInvalidOperError(userPostRating.Oper, nil)
+// GetUserOpers returns the user's opers for postIds in one query, keyed by post id.
+// Posts the user never voted on are absent from the map.
+func (s *UserPostRatingStorage) GetUserOpers(ctx context.Context, userId int64, postIds []string) (opers map[string]rune, err error) {
+	opers = make(map[string]rune, len(postIds))
+	if len(postIds) == 0 {
+		return opers, nil
 	}
+	ctx, span := tracing.Start(ctx, "UserPostRatingStorage.GetUserOpers", attribute.Int("posts", len(postIds)))
+	defer tracing.End(span, &err)
 
-	existing, err := s.GetUserOper(userPostRating.UserId, userPostRating.PostId)
-
-	if pgxscan.NotFound(err) {
-		return s.CreateUserOper(userPostRating)
+	rows, err := s.conn.Query(ctx, "SELECT \"userId\", \"postId\"::text, oper "+
+		"\n FROM "+s.tableName+
+		"\n WHERE \"userId\" = $1"+
+		"\n AND \"postId\" = ANY($2::uuid[])", userId, postIds)
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Println("Existing oper: ", existing.Oper, "newOper: ", userPostRating.Oper)
-	if existing.Oper == userPostRating.Oper && existing.Oper != OperNone {
-		return NewDoubleOperError(userPostRating.Oper, nil, userPostRating)
+	var userPostRatings []models.UserPostRating
+	if err := pgxscan.ScanAll(&userPostRatings, rows); err != nil {
+		return nil, err
 	}
-
-	if existing.Oper == OperNone {
-		return nil
+	for _, userPostRating := range userPostRatings {
+		opers[userPostRating.PostId] = userPostRating.Oper
 	}
 
-	newOperDelta := operToDelta[existing.Oper] + operToDelta[userPostRating.Oper]
-	newOper := deltaToOper[newOperDelta]
+	return opers, nil
+}
 
-	existing.Oper = newOper
-	return s.UpdateUserOper(userPostRating)
+// VoteResult is the outcome of ApplyVote: the post rating and the user's vote after it.
+type VoteResult struct {
+	Rating int
+	Vote   int
+	// Changed tells whether the vote changed, RatingChanged whether the rating did,
+	// which a repeated or quarantined vote doesn't.
+	Changed       bool
+	RatingChanged bool
 }
 
-func (s *UserPostRatingStorage) UpdateUserOper(newUserPostRating *models.UserPostRating) error {
-	if !s.OperAllowed(newUserPostRating.Oper) {
-		return errors.New("invalid oper")
+// ApplyVote sets the user's vote to the value returned by next and moves the post
+// rating by the difference in one transaction. The post row is locked first, so
+// concurrent votes on the same post are serialized and the rating can't drift.
+// Votes flagged by the anomaly rules are stored quarantined and don't count
+// towards the rating until a moderator approves them.
+// pgx.ErrNoRows means the post does not exist.
+func (s *UserPostRatingStorage) ApplyVote(ctx context.Context, userVk *cache.UserVk, postId string,
+	next func(current int) (int, error)) (_ *VoteResult, err error) {
+	ctx, span := tracing.Start(ctx, "UserPostRatingStorage.ApplyVote", attribute.String("post.id", postId))
+	defer tracing.End(span, &err)
+
+	userId := userVk.Info.Id
+	var result VoteResult
+	err = pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, "SELECT rating FROM "+s.postsTableName+
+			"\n WHERE id=$1 FOR UPDATE", postId).Scan(&result.Rating); err != nil {
+			return err
+		}
+
+		current := 0
+		var oper rune
+		var wasQuarantined bool
+		err := tx.QueryRow(ctx, "SELECT oper, quarantined FROM "+s.tableName+
+			"\n WHERE \"userId\"=$1 AND \"postId\"=$2 FOR UPDATE", userId, postId).Scan(&oper, &wasQuarantined)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			current = operToDelta[oper]
+		}
+
+		value, err := next(current)
+		if err != nil {
+			return err
+		}
+		result.Vote = value
+		newOper, ok := deltaToOper[value]
+		if !ok {
+			return errors.New("invalid vote value")
+		}
+		if value == current {
+			return nil
+		}
+		result.Changed = true
+
+		newSession := s.anomalyRules.isNewSession(userVk)
+		reason, err := s.anomalyRules.detect(ctx, tx, s.tableName, userId, postId, value, newSession)
+		if err != nil {
+			return err
+		}
+		quarantined := reason != ""
+
+		if _, err := tx.Exec(ctx, "INSERT INTO "+s.tableName+
+			"\n (\"userId\", \"postId\", oper, \"votedAt\", \"newSession\", quarantined)"+
+			"\n VALUES ($1, $2, $3, now(), $4, $5)"+
+			"\n ON CONFLICT (\"userId\", \"postId\") DO UPDATE SET oper=EXCLUDED.oper,"+
+			"\n \"votedAt\"=EXCLUDED.\"votedAt\", \"newSession\"=EXCLUDED.\"newSession\", quarantined=EXCLUDED.quarantined",
+			userId, postId, newOper, newSession, quarantined); err != nil {
+			return err
+		}
+		if err := s.replaceFlag(ctx, tx, userId, postId, value, reason); err != nil {
+			return err
+		}
+
+		counted, currentCounted := value, current
+		if quarantined {
+			counted = 0
+		}
+		if wasQuarantined {
+			currentCounted = 0
+		}
+		if counted == currentCounted {
+			return nil
+		}
+		result.RatingChanged = true
+
+		upDelta, downDelta := voteCounts(counted)
+		currentUp, currentDown := voteCounts(currentCounted)
+		return tx.QueryRow(ctx, "UPDATE "+s.postsTableName+
+			"\n SET rating=rating+$2, upvotes=upvotes+$3, downvotes=downvotes+$4"+
+			"\n WHERE id=$1"+
+			"\n RETURNING rating", postId, counted-currentCounted, upDelta-currentUp, downDelta-currentDown).Scan(&result.Rating)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := s.conn.Exec(context.Background(), "UPDATE "+s.tableName+
-		"\n SET oper=$3"+
-		"\n WHERE \"userId\"=$1 AND \"postId\"=$2", newUserPostRating.UserId, newUserPostRating.PostId, newUserPostRating.Oper)
+	return &result, nil
+}
+
+// ReconcileRatings recomputes every post rating from the non-quarantined votes and
+// fixes the posts whose stored rating drifted. Votes are blocked while it runs. It locks
+// the posts before the votes, in the order ApplyVote does, so the two can't deadlock.
+func (s *UserPostRatingStorage) ReconcileRatings(ctx context.Context) ([]models.RatingDrift, error) {
+	var drifts []models.RatingDrift
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM "+s.postsTableName+
+			"\n ORDER BY id FOR UPDATE"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "LOCK TABLE "+s.tableName+" IN SHARE MODE"); err != nil {
+			return err
+		}
 
-	return err
+		rows, err := tx.Query(ctx, "WITH computed AS ("+
+			"\n SELECT p.id, p.rating AS old,"+
+			"\n COUNT(*) FILTER (WHERE r.oper = '+' AND NOT r.quarantined) AS up,"+
+			"\n COUNT(*) FILTER (WHERE r.oper = '-' AND NOT r.quarantined) AS down"+
+			"\n FROM "+s.postsTableName+" p"+
+			"\n LEFT JOIN "+s.tableName+" r ON r.\"postId\" = p.id"+
+			"\n GROUP BY p.id"+
+			"\n )"+
+			"\n UPDATE "+s.postsTableName+" p"+
+			"\n SET rating = c.up - c.down, upvotes = c.up, downvotes = c.down"+
+			"\n FROM computed c"+
+			"\n WHERE p.id = c.id"+
+			"\n AND (p.rating <> c.up - c.down OR p.upvotes <> c.up OR p.downvotes <> c.down)"+
+			"\n RETURNING p.id::text AS \"postId\", c.old, p.rating AS new")
+		if err != nil {
+			return err
+		}
+		return pgxscan.ScanAll(&drifts, rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
 }
 
-func (s *UserPostRatingStorage) CreateUserOper(userPostRating *models.UserPostRating) error {
-	if !s.OperAllowed(userPostRating.Oper) {
-		return errors.New("invalid oper")
+// voteCounts returns how a vote contributes to the upvote and downvote counters.
+func voteCounts(vote int) (int, int) {
+	switch vote {
+	case 1:
+		return 1, 0
+	case -1:
+		return 0, 1
 	}
+	return 0, 0
+}
 
-	_, err := s.conn.Exec(context.Background(), "INSERT INTO "+s.tableName+" ("+
-		"\n\t \"userId\", \"postId\", oper)"+
-		"\n\t  VALUES ($1, $2, $3);", userPostRating.UserId, userPostRating.PostId, userPostRating.Oper)
+// NextVote returns the vote obtained by applying oper to current.
+func (s *UserPostRatingStorage) NextVote(current int, oper rune) (int, error) {
+	if !s.OperAllowed(oper) {
+		return 0, &InvalidOperError{Oper: oper}
+	}
 
-	return err
+	next := current + operToDelta[oper]
+	if _, ok := deltaToOper[next]; !ok {
+		return 0, &DoubleOperError{Oper: oper, Vote: current}
+	}
+	return next, nil
 }
 
 func (s *UserPostRatingStorage) OperAllowed(oper rune) bool {
@@ -0,0 +1,91 @@
+package storages
+
+import (
+	"TaskService/models/cache"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	FlagReasonRapidVoting   = "rapid_voting"
+	FlagReasonNewSessions   = "new_session_burst"
+	FlagReasonDownvoteBurst = "downvote_burst"
+)
+
+// VoteAnomalyRules are the thresholds of the brigading detector. A zero count disables its rule.
+type VoteAnomalyRules struct {
+	// RapidVotes votes by one user within RapidWindow flag the next one.
+	RapidVotes  int
+	RapidWindow time.Duration
+
+	// Sessions younger than NewSessionAge are new. NewSessionVotes votes on a post
+	// from new sessions within BurstWindow flag further votes from new sessions.
+	NewSessionAge   time.Duration
+	NewSessionVotes int
+
+	// DownvoteBurst downvotes on a post within BurstWindow flag further downvotes.
+	DownvoteBurst int
+	BurstWindow   time.Duration
+}
+
+func DefaultVoteAnomalyRules() VoteAnomalyRules {
+	return VoteAnomalyRules{
+		RapidVotes:      10,
+		RapidWindow:     30 * time.Second,
+		NewSessionAge:   time.Hour,
+		NewSessionVotes: 5,
+		DownvoteBurst:   15,
+		BurstWindow:     10 * time.Minute,
+	}
+}
+
+func (r VoteAnomalyRules) isNewSession(userVk *cache.UserVk) bool {
+	return !userVk.CreatedAt.IsZero() && time.Since(userVk.CreatedAt) < r.NewSessionAge
+}
+
+// detect returns the reason to quarantine the vote, or "" when it looks legitimate.
+// It runs inside the vote transaction, after the post row is locked.
+func (r VoteAnomalyRules) detect(ctx context.Context, tx pgx.Tx, tableName string, userId int64, postId string, value int, newSession bool) (string, error) {
+	if value == 0 {
+		return "", nil
+	}
+
+	if r.RapidVotes > 0 {
+		var count int
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM "+tableName+
+			"\n WHERE \"userId\"=$1 AND \"postId\"<>$2 AND \"votedAt\">$3",
+			userId, postId, time.Now().Add(-r.RapidWindow)).Scan(&count); err != nil {
+			return "", err
+		}
+		if count >= r.RapidVotes {
+			return FlagReasonRapidVoting, nil
+		}
+	}
+
+	if r.NewSessionVotes > 0 && newSession {
+		var count int
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM "+tableName+
+			"\n WHERE \"postId\"=$1 AND \"userId\"<>$2 AND \"newSession\" AND oper<>'0' AND \"votedAt\">$3",
+			postId, userId, time.Now().Add(-r.BurstWindow)).Scan(&count); err != nil {
+			return "", err
+		}
+		if count >= r.NewSessionVotes {
+			return FlagReasonNewSessions, nil
+		}
+	}
+
+	if r.DownvoteBurst > 0 && value < 0 {
+		var count int
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM "+tableName+
+			"\n WHERE \"postId\"=$1 AND \"userId\"<>$2 AND oper='-' AND \"votedAt\">$3",
+			postId, userId, time.Now().Add(-r.BurstWindow)).Scan(&count); err != nil {
+			return "", err
+		}
+		if count >= r.DownvoteBurst {
+			return FlagReasonDownvoteBurst, nil
+		}
+	}
+
+	return "", nil
+}
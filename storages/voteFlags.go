@@ -0,0 +1,158 @@
+package storages
+
+import (
+	"TaskService/logging"
+	"TaskService/models"
+	"context"
+	"errors"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrFlagReviewed = errors.New("vote flag is already reviewed")
+
+func (s *UserPostRatingStorage) createFlagsTableIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.flagsTableName+
+		"\n ("+
+		"\n id bigserial NOT NULL,"+
+		"\n \"userId\" bigint NOT NULL,"+
+		"\n \"postId\" uuid NOT NULL,"+
+		"\n value integer NOT NULL,"+
+		"\n reason text NOT NULL,"+
+		"\n status text NOT NULL DEFAULT 'pending',"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n \"reviewedBy\" bigint,"+
+		"\n \"reviewedAt\" timestamp with time zone,"+
+		"\n CONSTRAINT \"VoteFlags_pkey\" PRIMARY KEY (id),"+
+		"\n CONSTRAINT \"VoteFlags_postId_fkey\" FOREIGN KEY (\"postId\")"+
+		"\n REFERENCES public.\"Posts\" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// replaceFlag drops the user's pending flag on the post, which a new vote supersedes,
+// and records a new one when reason is set.
+func (s *UserPostRatingStorage) replaceFlag(ctx context.Context, tx pgx.Tx, userId int64, postId string, value int, reason string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM "+s.flagsTableName+
+		"\n WHERE \"userId\"=$1 AND \"postId\"=$2 AND status=$3", userId, postId, models.VoteFlagPending); err != nil {
+		return err
+	}
+	if reason == "" {
+		return nil
+	}
+
+	logging.FromContext(ctx).Info("quarantined vote", "user", userId, "post", postId, "reason", reason)
+	_, err := tx.Exec(ctx, "INSERT INTO "+s.flagsTableName+
+		"\n (\"userId\", \"postId\", value, reason) VALUES ($1, $2, $3, $4)", userId, postId, value, reason)
+	return err
+}
+
+// GetFlags returns a page of flags with the status, oldest first, and their total count.
+func (s *UserPostRatingStorage) GetFlags(ctx context.Context, status string, size, page int) ([]models.VoteFlag, int, error) {
+	var total int
+	if err := s.conn.QueryRow(ctx, "SELECT count(*) FROM "+s.flagsTableName+
+		"\n WHERE status=$1", status).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT id, \"userId\", \"postId\"::text, value, reason, status,"+
+		"\n \"createdAt\", \"reviewedBy\", \"reviewedAt\""+
+		"\n FROM "+s.flagsTableName+
+		"\n WHERE status=$1"+
+		"\n ORDER BY \"createdAt\""+
+		"\n LIMIT $2 OFFSET $3", status, size, size*(page-1))
+	if err != nil {
+		return nil, 0, err
+	}
+	flags := make([]models.VoteFlag, 0)
+	if err := pgxscan.ScanAll(&flags, rows); err != nil {
+		return nil, 0, err
+	}
+
+	return flags, total, nil
+}
+
+// ReviewFlag resolves a pending flag. Approving releases the quarantined vote into
+// the post rating; voiding deletes the vote. It returns the new post rating when the
+// review changed it. pgx.ErrNoRows means no such flag.
+func (s *UserPostRatingStorage) ReviewFlag(ctx context.Context, flagId int64, approve bool, moderatorId int64) (*models.VoteFlag, *int, error) {
+	var flag models.VoteFlag
+	var rating *int
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id, \"userId\", \"postId\"::text, value, reason, status,"+
+			"\n \"createdAt\", \"reviewedBy\", \"reviewedAt\""+
+			"\n FROM "+s.flagsTableName+
+			"\n WHERE id=$1 FOR UPDATE", flagId)
+		if err != nil {
+			return err
+		}
+		if err := pgxscan.ScanOne(&flag, rows); err != nil {
+			if pgxscan.NotFound(err) {
+				return pgx.ErrNoRows
+			}
+			return err
+		}
+		if flag.Status != models.VoteFlagPending {
+			return ErrFlagReviewed
+		}
+
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM "+s.postsTableName+
+			"\n WHERE id=$1 FOR UPDATE", flag.PostId); err != nil {
+			return err
+		}
+
+		var oper rune
+		err = tx.QueryRow(ctx, "SELECT oper FROM "+s.tableName+
+			"\n WHERE \"userId\"=$1 AND \"postId\"=$2 AND quarantined FOR UPDATE", flag.UserId, flag.PostId).Scan(&oper)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			if approve {
+				released, err := s.releaseVote(ctx, tx, flag.UserId, flag.PostId, operToDelta[oper])
+				if err != nil {
+					return err
+				}
+				rating = &released
+			} else if _, err := tx.Exec(ctx, "DELETE FROM "+s.tableName+
+				"\n WHERE \"userId\"=$1 AND \"postId\"=$2", flag.UserId, flag.PostId); err != nil {
+				return err
+			}
+		}
+
+		flag.Status = models.VoteFlagVoided
+		if approve {
+			flag.Status = models.VoteFlagApproved
+		}
+		return tx.QueryRow(ctx, "UPDATE "+s.flagsTableName+
+			"\n SET status=$2, \"reviewedBy\"=$3, \"reviewedAt\"=now()"+
+			"\n WHERE id=$1"+
+			"\n RETURNING \"reviewedBy\", \"reviewedAt\"", flag.Id, flag.Status, moderatorId).Scan(&flag.ReviewedBy, &flag.ReviewedAt)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &flag, rating, nil
+}
+
+// releaseVote lifts the quarantine of a vote, adds it to the post rating and returns the rating.
+func (s *UserPostRatingStorage) releaseVote(ctx context.Context, tx pgx.Tx, userId int64, postId string, value int) (int, error) {
+	if _, err := tx.Exec(ctx, "UPDATE "+s.tableName+
+		"\n SET quarantined=false"+
+		"\n WHERE \"userId\"=$1 AND \"postId\"=$2", userId, postId); err != nil {
+		return 0, err
+	}
+
+	up, down := voteCounts(value)
+	var rating int
+	err := tx.QueryRow(ctx, "UPDATE "+s.postsTableName+
+		"\n SET rating=rating+$2, upvotes=upvotes+$3, downvotes=downvotes+$4"+
+		"\n WHERE id=$1"+
+		"\n RETURNING rating", postId, value, up, down).Scan(&rating)
+	return rating, err
+}
@@ -0,0 +1,281 @@
+package storages
+
+import (
+	"TaskService/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// WebhookStorage keeps webhook subscriptions and their delivery log, which doubles as
+// the outbox: deliveries are enqueued in the transaction of the post change and claimed
+// by the dispatcher with a lease, so a change is delivered at least once.
+type WebhookStorage struct {
+	conn                *pgxpool.Pool
+	logger              *slog.Logger
+	tableName           string
+	deliveriesTableName string
+}
+
+func NewWebhookStorage(logger *slog.Logger, conn *pgxpool.Pool) *WebhookStorage {
+	stor := &WebhookStorage{
+		conn:                conn,
+		logger:              logger,
+		tableName:           "public.\"Webhooks\"",
+		deliveriesTableName: "public.\"WebhookDeliveries\"",
+	}
+	stor.createTablesIfNotExist()
+
+	return stor
+}
+
+func (s *WebhookStorage) createTablesIfNotExist() {
+	_, err := s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.tableName+
+		"\n ("+
+		"\n id uuid NOT NULL,"+
+		"\n url text NOT NULL,"+
+		"\n events text[] NOT NULL DEFAULT '{}',"+
+		"\n secret text NOT NULL,"+
+		"\n active boolean NOT NULL DEFAULT true,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n CONSTRAINT \"Webhooks_pkey\" PRIMARY KEY (id)"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS "+s.deliveriesTableName+
+		"\n ("+
+		"\n id bigserial NOT NULL,"+
+		"\n \"webhookId\" uuid NOT NULL,"+
+		"\n event text NOT NULL,"+
+		"\n payload jsonb NOT NULL,"+
+		"\n status text NOT NULL DEFAULT 'pending',"+
+		"\n attempts integer NOT NULL DEFAULT 0,"+
+		"\n \"nextAttemptAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n \"responseCode\" integer,"+
+		"\n \"lastError\" text,"+
+		"\n \"createdAt\" timestamp with time zone NOT NULL DEFAULT now(),"+
+		"\n \"deliveredAt\" timestamp with time zone,"+
+		"\n CONSTRAINT \"WebhookDeliveries_pkey\" PRIMARY KEY (id),"+
+		"\n CONSTRAINT \"WebhookDeliveries_webhookId_fkey\" FOREIGN KEY (\"webhookId\")"+
+		"\n REFERENCES "+s.tableName+" (id) MATCH SIMPLE"+
+		"\n ON UPDATE NO ACTION"+
+		"\n ON DELETE CASCADE"+
+		"\n )")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.conn.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS \"WebhookDeliveries_due\" ON "+
+		s.deliveriesTableName+" (\"nextAttemptAt\") WHERE status = 'pending'")
+	if err != nil {
+		panic(err)
+	}
+}
+
+const webhookColumns = "id::text AS id, url, events, active, \"createdAt\""
+
+func (s *WebhookStorage) GetAll(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+webhookColumns+
+		"\n FROM "+s.tableName+
+		"\n ORDER BY \"createdAt\"")
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]models.Webhook, 0)
+	if err := pgxscan.ScanAll(&webhooks, rows); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetOne returns the webhook without its secret. pgx.ErrNoRows means it does not exist.
+func (s *WebhookStorage) GetOne(ctx context.Context, id string) (*models.Webhook, error) {
+	rows, err := s.conn.Query(ctx, "SELECT "+webhookColumns+
+		"\n FROM "+s.tableName+
+		"\n WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	var webhook models.Webhook
+	if err := pgxscan.ScanOne(&webhook, rows); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Create saves the webhook, generating its secret unless given, and returns it with the secret.
+func (s *WebhookStorage) Create(ctx context.Context, webhookDto *models.WebhookDTO) (*models.Webhook, error) {
+	secret := webhookDto.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	active := webhookDto.Active == nil || *webhookDto.Active
+
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.tableName+
+		"\n (id, url, events, secret, active) VALUES ($1, $2, $3, $4, $5)"+
+		"\n RETURNING "+webhookColumns+", secret",
+		uuid.New().String(), webhookDto.Url, eventsOrEmpty(webhookDto.Events), secret, active)
+	if err != nil {
+		return nil, err
+	}
+	var webhook models.Webhook
+	if err := pgxscan.ScanOne(&webhook, rows); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Update changes the webhook, keeping the secret and active state unless given.
+func (s *WebhookStorage) Update(ctx context.Context, id string, webhookDto *models.WebhookDTO) (*models.Webhook, error) {
+	rows, err := s.conn.Query(ctx, "UPDATE "+s.tableName+
+		"\n SET url=$2, events=$3, secret=COALESCE($4, secret), active=COALESCE($5, active)"+
+		"\n WHERE id=$1"+
+		"\n RETURNING "+webhookColumns,
+		id, webhookDto.Url, eventsOrEmpty(webhookDto.Events), nullIfEmpty(webhookDto.Secret), webhookDto.Active)
+	if err != nil {
+		return nil, err
+	}
+	var webhook models.Webhook
+	if err := pgxscan.ScanOne(&webhook, rows); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Delete removes the webhook with its delivery log.
+func (s *WebhookStorage) Delete(ctx context.Context, id string) (bool, error) {
+	tag, err := s.conn.Exec(ctx, "DELETE FROM "+s.tableName+" WHERE id=$1", id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func eventsOrEmpty(events []string) []string {
+	if events == nil {
+		return []string{}
+	}
+	return events
+}
+
+// enqueue queues the event for every active webhook subscribed to it, in the caller's transaction.
+func (s *WebhookStorage) enqueue(ctx context.Context, tx pgx.Tx, event string, post interface{}) error {
+	payload, err := json.Marshal(models.PostEvent{Event: event, OccurredAt: time.Now().UTC(), Post: post})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO "+s.deliveriesTableName+
+		"\n (\"webhookId\", event, payload)"+
+		"\n SELECT id, $1, $2 FROM "+s.tableName+
+		"\n WHERE active AND (cardinality(events) = 0 OR $1 = ANY(events))", event, payload)
+	return err
+}
+
+const deliveryColumns = "d.id, d.\"webhookId\"::text AS \"webhookId\", d.event, d.payload, d.status, d.attempts," +
+	" d.\"responseCode\", d.\"lastError\", d.\"createdAt\", d.\"deliveredAt\""
+
+// GetDeliveries returns a page of the webhook's delivery log, newest first, and the total count.
+func (s *WebhookStorage) GetDeliveries(ctx context.Context, webhookId string, size, page int) ([]models.WebhookDelivery, int, error) {
+	var total int
+	if err := s.conn.QueryRow(ctx, "SELECT count(*) FROM "+s.deliveriesTableName+
+		"\n WHERE \"webhookId\"=$1", webhookId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT "+deliveryColumns+
+		"\n FROM "+s.deliveriesTableName+" d"+
+		"\n WHERE d.\"webhookId\"=$1"+
+		"\n ORDER BY d.id DESC"+
+		"\n LIMIT $2 OFFSET $3", webhookId, size, size*(page-1))
+	if err != nil {
+		return nil, 0, err
+	}
+	deliveries := make([]models.WebhookDelivery, 0)
+	if err := pgxscan.ScanAll(&deliveries, rows); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// Redeliver queues the payload of a past delivery again as a new delivery, keeping the
+// old one in the log. pgx.ErrNoRows means the delivery does not belong to the webhook.
+func (s *WebhookStorage) Redeliver(ctx context.Context, webhookId string, deliveryId int64) (*models.WebhookDelivery, error) {
+	rows, err := s.conn.Query(ctx, "INSERT INTO "+s.deliveriesTableName+" AS d"+
+		"\n (\"webhookId\", event, payload)"+
+		"\n SELECT \"webhookId\", event, payload FROM "+s.deliveriesTableName+
+		"\n WHERE id=$1 AND \"webhookId\"=$2"+
+		"\n RETURNING "+deliveryColumns, deliveryId, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	var delivery models.WebhookDelivery
+	if err := pgxscan.ScanOne(&delivery, rows); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimDue leases up to limit due deliveries of active webhooks to the caller for lease
+// and counts the attempt.
+func (s *WebhookStorage) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn.Query(ctx, "UPDATE "+s.deliveriesTableName+" d"+
+		"\n SET attempts=d.attempts+1, \"nextAttemptAt\"=now() + make_interval(secs => $2)"+
+		"\n FROM "+s.tableName+" w"+
+		"\n WHERE w.id = d.\"webhookId\" AND w.active AND d.id IN (SELECT id FROM "+s.deliveriesTableName+
+		"\n WHERE status='"+models.DeliveryPending+"' AND \"nextAttemptAt\" <= now()"+
+		"\n ORDER BY \"nextAttemptAt\""+
+		"\n LIMIT $1"+
+		"\n FOR UPDATE SKIP LOCKED)"+
+		"\n RETURNING "+deliveryColumns+", w.url, w.secret", limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]models.WebhookDelivery, 0)
+	if err := pgxscan.ScanAll(&deliveries, rows); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt logs the outcome of an attempt. A failed delivery is retried at retryAt,
+// or given up on when it's nil.
+func (s *WebhookStorage) RecordAttempt(ctx context.Context, id int64, responseCode *int, attemptErr error, retryAt *time.Time) error {
+	status := models.DeliveryDelivered
+	var lastError *string
+	if attemptErr != nil {
+		status = models.DeliveryFailed
+		if retryAt != nil {
+			status = models.DeliveryPending
+		}
+		msg := attemptErr.Error()
+		lastError = &msg
+	}
+	_, err := s.conn.Exec(ctx, "UPDATE "+s.deliveriesTableName+
+		"\n SET status=$2, \"responseCode\"=$3, \"lastError\"=$4,"+
+		"\n \"nextAttemptAt\"=COALESCE($5, \"nextAttemptAt\"),"+
+		"\n \"deliveredAt\"=CASE WHEN $2='"+models.DeliveryDelivered+"' THEN now() END"+
+		"\n WHERE id=$1", id, status, responseCode, lastError, retryAt)
+	return err
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"TaskService/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Middleware starts a server span for every request, continuing the trace of the
+// traceparent header when present. Spans are named by the mux route template, and
+// the request logger gets the trace id to correlate logs with traces.
+func Middleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(semconv.HTTPRoute(routeTemplate(r)))
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			logger := logging.FromContext(r.Context()).With("traceId", spanContext.TraceID().String())
+			r = r.WithContext(logging.WithLogger(r.Context(), logger))
+		}
+		next.ServeHTTP(w, r)
+	})
+	return otelhttp.NewHandler(routed, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + routeTemplate(r)
+		}))
+}
+
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unknown"
+}
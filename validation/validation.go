@@ -0,0 +1,232 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors maps the json name of each invalid field to what is wrong with it.
+type Errors map[string]string
+
+// Add records the first problem of field; later ones wait until it is fixed.
+func (e Errors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// ErrMalformed is a body that is not a JSON object at all.
+var ErrMalformed = errors.New("body is not a JSON object")
+
+// Decode reads the JSON object in body into dto, a pointer to a struct, and validates it.
+// Keys that dto has no field for are violations too, so a client can't set what it isn't
+// meant to, and so are values of the wrong JSON type, each of them. It returns ErrMalformed
+// when body isn't a JSON object, and the violations otherwise, empty when dto is valid.
+func Decode(body io.Reader, dto any) (Errors, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(content, &keys); err != nil || keys == nil {
+		return nil, ErrMalformed
+	}
+
+	violations := Errors{}
+	fields := jsonFields(reflect.TypeOf(dto).Elem())
+	for key, raw := range keys {
+		field, ok := fields[key]
+		if !ok {
+			violations.Add(key, "unknown field")
+			continue
+		}
+		// The decoder stops reporting at the first mistyped field, so each is tried alone.
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(raw, reflect.New(field.Type).Interface()); errors.As(err, &typeErr) {
+			violations.Add(key, "must be "+jsonKind(typeErr.Type))
+		}
+	}
+
+	// Decoding goes on past mistyped fields, so the others are still validated below.
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(content, dto); err != nil && !errors.As(err, &typeErr) {
+		return nil, ErrMalformed
+	}
+
+	for field, message := range Struct(dto) {
+		violations.Add(field, message)
+	}
+	return violations, nil
+}
+
+// Struct checks the fields of v, a struct or a pointer to one, against their validate
+// tags and returns every violation. Rules are comma separated:
+//
+//	required       not empty, or not nil for a pointer
+//	min=N, max=N   bounds of a number, or of the length of a string or list
+//	uuid           a UUID
+//	url=a|b        an absolute URL with one of the schemes
+//	oneof=a|b      one of the values, for every item of a list
+//
+// Rules other than required skip a nil pointer, so optional fields are checked only when set.
+// uuid and url accept an empty string too, unless it is behind a pointer.
+func Struct(v any) Errors {
+	violations := Errors{}
+	value := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := jsonName(field)
+		for _, rule := range strings.Split(tag, ",") {
+			if message := check(value.Field(i), rule); message != "" {
+				violations.Add(name, message)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// check returns what's wrong with value under rule, or "" when it complies.
+func check(value reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	optional := true
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		if name == "required" {
+			return ""
+		}
+		value, optional = value.Elem(), false
+	}
+
+	switch name {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") ||
+			(value.Kind() == reflect.Slice && value.Len() == 0) {
+			return "is required"
+		}
+	case "min", "max":
+		bound, err := strconv.Atoi(arg)
+		if err != nil {
+			panic("validation: invalid bound in rule " + rule)
+		}
+		return checkBound(value, name, bound)
+	case "uuid":
+		if value.String() != "" || !optional {
+			if _, err := uuid.Parse(value.String()); err != nil {
+				return "must be a UUID"
+			}
+		}
+	case "url":
+		if (value.String() != "" || !optional) && !hasScheme(value.String(), strings.Split(arg, "|")) {
+			return "must be an absolute " + strings.Join(strings.Split(arg, "|"), " or ") + " URL"
+		}
+	case "oneof":
+		allowed := strings.Split(arg, "|")
+		items := []reflect.Value{value}
+		if value.Kind() == reflect.Slice {
+			items = items[:0]
+			for i := 0; i < value.Len(); i++ {
+				items = append(items, value.Index(i))
+			}
+		}
+		for _, item := range items {
+			if !contains(allowed, item.String()) {
+				return fmt.Sprintf("%q is not one of %s", item.String(), strings.Join(allowed, ", "))
+			}
+		}
+	default:
+		panic("validation: unknown rule " + rule)
+	}
+	return ""
+}
+
+func checkBound(value reflect.Value, name string, bound int) string {
+	var actual int
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		actual, unit = utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice:
+		actual, unit = value.Len(), " items"
+	case reflect.Int, reflect.Int64:
+		actual = int(value.Int())
+	default:
+		panic("validation: min and max don't apply to " + value.Kind().String())
+	}
+	if name == "min" && actual < bound {
+		return fmt.Sprintf("must be at least %d%s", bound, unit)
+	}
+	if name == "max" && actual > bound {
+		return fmt.Sprintf("must be at most %d%s", bound, unit)
+	}
+	return ""
+}
+
+func hasScheme(value string, schemes []string) bool {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return contains(schemes, parsed.Scheme)
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFields returns the fields a struct decodes by their json names.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.IsExported() && field.Tag.Get("json") != "-" {
+			fields[jsonName(field)] = field
+		}
+	}
+	return fields
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// jsonKind names the JSON value a Go type decodes from.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
@@ -0,0 +1,42 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testDTO struct {
+	Title string   `json:"title" validate:"required,max=10"`
+	Count *int     `json:"count" validate:"min=1"`
+	Tags  []string `json:"tags"`
+	Id    string   `json:"id" validate:"uuid"`
+}
+
+func TestDecodeReportsEveryViolation(t *testing.T) {
+	var dto testDTO
+	violations, err := Decode(strings.NewReader(
+		`{"title": 5, "count": "two", "tags": [1], "id": "nope", "extra": true}`), &dto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Errors{
+		"title": "must be a string",
+		"count": "must be a number",
+		"tags":  "must be a string",
+		"id":    "must be a UUID",
+		"extra": "unknown field",
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("Decode() violations = %v, want %v", violations, want)
+	}
+}
+
+func TestDecodeRejectsNonObjects(t *testing.T) {
+	for _, body := range []string{``, `[]`, `null`, `"title"`, `{"title": "a"`} {
+		var dto testDTO
+		if _, err := Decode(strings.NewReader(body), &dto); err != ErrMalformed {
+			t.Errorf("Decode(%q) error = %v, want ErrMalformed", body, err)
+		}
+	}
+}